@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// collision is a Swift name that more than one proto entity maps to, which
+// SwiftProtobuf would turn into code that does not compile.
+type collision struct {
+	swiftName  string
+	protoNames []string
+}
+
+// findCollisions groups entries by their fully qualified Swift name and
+// returns the groups with more than one proto name, sorted by Swift name.
+func findCollisions(entries []entry) []collision {
+	protoNames := make(map[string][]string)
+	for _, e := range entries {
+		protoNames[e.swiftName] = append(protoNames[e.swiftName], e.protoName)
+	}
+	var collisions []collision
+	for swiftName, names := range protoNames {
+		if len(names) > 1 {
+			sort.Strings(names)
+			collisions = append(collisions, collision{swiftName: swiftName, protoNames: names})
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		return collisions[i].swiftName < collisions[j].swiftName
+	})
+	return collisions
+}
+
+// collisionsOf returns the collisions involving any of entries.
+func collisionsOf(collisions []collision, entries []entry) []collision {
+	protoNames := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		protoNames[e.protoName] = true
+	}
+	var involved []collision
+	for _, c := range collisions {
+		for _, protoName := range c.protoNames {
+			if protoNames[protoName] {
+				involved = append(involved, c)
+				break
+			}
+		}
+	}
+	return involved
+}
+
+// collisionError reports collisions as an error.
+func collisionError(collisions []collision) error {
+	report := new(strings.Builder)
+	writeCollisions(&lineWriter{w: report}, collisions, "")
+	return errors.New(strings.TrimRight(report.String(), opts.lineEnding))
+}
+
+// writeCollisions writes a report of collisions, each line starting with
+// prefix so it can be embedded as comments. Past max_collisions, the
+// remaining collisions are only counted.
+func writeCollisions(w *lineWriter, collisions []collision, prefix string) {
+	w.writeLine(prefix + "Swift name collisions:")
+	listed := collisions
+	if opts.maxCollisions > 0 && len(listed) > opts.maxCollisions {
+		listed = listed[:opts.maxCollisions]
+	}
+	for _, c := range listed {
+		w.writeLine(append([]string{prefix + c.swiftName}, c.protoNames...)...)
+	}
+	if len(listed) < len(collisions) {
+		w.writeLine(prefix + "... and " + strconv.Itoa(len(collisions)-len(listed)) + " more")
+	}
+}
+
+// rename records an entity whose Swift name collision_mode=suffix changed.
+type rename struct {
+	protoName string
+	from, to  string
+}
+
+// suffixCollisions makes every Swift name in entries unique. Within each
+// collision the proto name sorting first keeps the name and the others get
+// _2, _3 and so on, skipping suffixed names that are already taken. Nested
+// entities of a renamed one follow it to the new name.
+func suffixCollisions(entries []entry) []rename {
+	var renames []rename
+	for {
+		collisions := findCollisions(entries)
+		if len(collisions) == 0 {
+			return renames
+		}
+		// Fixing the first collision may also fix those of nested names, so
+		// the rest are recomputed afterwards.
+		c := collisions[0]
+		used := make(map[string]bool, len(entries))
+		for _, e := range entries {
+			used[e.swiftName] = true
+		}
+		n := 2
+		for _, protoName := range c.protoNames[1:] {
+			to := c.swiftName + "_" + strconv.Itoa(n)
+			for used[to] {
+				n++
+				to = c.swiftName + "_" + strconv.Itoa(n)
+			}
+			n++
+			used[to] = true
+			renameEntries(entries, protoName, c.swiftName, to)
+			renames = append(renames, rename{protoName: protoName, from: c.swiftName, to: to})
+		}
+	}
+}
+
+// renameEntries moves the entry for protoName and the entries nested in it
+// from the Swift name from to to. An entry is nested when its key extends
+// protoName, as the keys of enum values extend the key of their enum.
+func renameEntries(entries []entry, protoName, from, to string) {
+	for i := range entries {
+		e := &entries[i]
+		nested := strings.HasPrefix(e.protoName, protoName+".")
+		if e.protoName == protoName && e.swiftName == from {
+			e.swiftName = to
+		} else if nested && strings.HasPrefix(e.swiftName, from+opts.naming.Separator) {
+			e.swiftName = to + e.swiftName[len(from):]
+		}
+	}
+}
+
+// renamesOf returns the renames of any of entries.
+func renamesOf(renames []rename, entries []entry) []rename {
+	protoNames := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		protoNames[e.protoName] = true
+	}
+	var involved []rename
+	for _, r := range renames {
+		if protoNames[r.protoName] {
+			involved = append(involved, r)
+		}
+	}
+	return involved
+}
+
+// writeRenames writes a note for each rename, starting with prefix.
+func writeRenames(w *lineWriter, renames []rename, prefix string) {
+	for _, r := range renames {
+		w.writeLine(prefix+"renamed", r.protoName, r.from, "->", r.to)
+	}
+}
@@ -2,4 +2,4 @@ module github.com/ClarkGuan/protoc-gen-namer
 
 go 1.10
 
-require google.golang.org/protobuf v1.28.0 // indirect
+require google.golang.org/protobuf v1.28.0
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"unicode"
 
 	"google.golang.org/protobuf/proto"
@@ -13,10 +17,31 @@ import (
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/pluginpb"
+
+	"github.com/ClarkGuan/protoc-gen-namer/namer"
+)
+
+const (
+	pluginName    = "protoc-gen-namer"
+	pluginVersion = "0.1.0"
+)
+
+// input and output replace stdin and stdout, to run the plugin outside
+// protoc on a captured request.
+var (
+	input  = flag.String("input", "", "read the CodeGeneratorRequest from `path` instead of stdin")
+	output = flag.String("output", "", "write the CodeGeneratorResponse to `path` instead of stdout")
 )
 
 func main() {
-	readAll, err := io.ReadAll(os.Stdin)
+	flag.Parse()
+	var readAll []byte
+	var err error
+	if len(*input) > 0 {
+		readAll, err = os.ReadFile(*input)
+	} else {
+		readAll, err = io.ReadAll(os.Stdin)
+	}
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -24,413 +49,910 @@ func main() {
 	if err := proto.Unmarshal(readAll, req); err != nil {
 		log.Fatalln(err)
 	}
-	files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: req.ProtoFile})
+	content, err := proto.Marshal(respond(req))
 	if err != nil {
 		log.Fatalln(err)
 	}
-	buf := new(strings.Builder)
-	writer := io.MultiWriter(buf, os.Stderr)
-	for _, file := range req.ProtoFile {
-		fileDescriptor, err := files.FindFileByPath(file.GetName())
-		if err != nil {
-			log.Fatalln(err)
-		}
-		messages := fileDescriptor.Messages()
-		for i := 0; i < messages.Len(); i++ {
-			message := messages.Get(i)
-			displayMessage(writer, message)
-		}
-		enums := fileDescriptor.Enums()
-		for i := 0; i < enums.Len(); i++ {
-			enum := enums.Get(i)
-			displayEnum(writer, enum)
-		}
+	if len(*output) > 0 {
+		err = os.WriteFile(*output, content, 0644)
+	} else {
+		_, err = os.Stdout.Write(content)
 	}
-	resp := pluginpb.CodeGeneratorResponse{File: []*pluginpb.CodeGeneratorResponse_File{
-		{Name: proto.String("mapper.txt"), Content: proto.String(buf.String())}}}
-	content, err := proto.Marshal(&resp)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	_, err = os.Stdout.Write(content)
+}
+
+// supportedFeatures declares proto3 optional support: the mapping covers
+// those fields like any other, so protoc may pass files using them.
+const supportedFeatures = uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)
+
+// respond builds the response for req, setting its Error field when
+// generation fails: protoc reports the error of a well-formed response as the
+// plugin's, rather than as a plugin crash.
+func respond(req *pluginpb.CodeGeneratorRequest) *pluginpb.CodeGeneratorResponse {
+	resp, err := generate(req)
 	if err != nil {
-		log.Fatalln(err)
+		return &pluginpb.CodeGeneratorResponse{
+			Error:             proto.String(err.Error()),
+			SupportedFeatures: proto.Uint64(supportedFeatures),
+		}
 	}
+	return resp
 }
 
-func displayMessage(w io.Writer, message protoreflect.MessageDescriptor) {
-	_, _ = fmt.Fprintln(w, string(message.FullName()), fullNameOfMessage(message))
-	nestMessages := message.Messages()
-	for i := 0; i < nestMessages.Len(); i++ {
-		msg := nestMessages.Get(i)
-		displayMessage(w, msg)
+// generate builds the response for req: the mapping files and the extra
+// files asked for by the options.
+func generate(req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+	if err := parseOptions(req.GetParameter()); err != nil {
+		return nil, err
 	}
-	nestEnums := message.Enums()
-	for i := 0; i < nestEnums.Len(); i++ {
-		nestEnum := nestEnums.Get(i)
-		displayEnum(w, nestEnum)
+	if err := checkCompilerVersion(req.GetCompilerVersion()); err != nil {
+		return nil, err
 	}
-}
-
-func displayEnum(w io.Writer, enum protoreflect.EnumDescriptor) {
-	_, _ = fmt.Fprintln(w, string(enum.FullName()), fullNameOfEnum(enum))
-}
-
-func fullNameOfMessage(message protoreflect.MessageDescriptor) string {
-	relativeName := relativeNameOfMessage(message)
-	if container, ok := message.Parent().(protoreflect.MessageDescriptor); ok {
-		return fullNameOfMessage(container) + "." + relativeName
+	if err := checkEditions(req.ProtoFile); err != nil {
+		return nil, err
+	}
+	files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: req.ProtoFile})
+	if err != nil {
+		return nil, err
+	}
+	// protoc passes the imports of the files to generate too; they are only
+	// mapped under include_imports.
+	paths := req.FileToGenerate
+	if opts.includeImports {
+		paths = make([]string, 0, len(req.ProtoFile))
+		for _, file := range req.ProtoFile {
+			paths = append(paths, file.GetName())
+		}
+	}
+	packageFiles := make(map[string][]string)
+	fileDescriptors := make([]protoreflect.FileDescriptor, 0, len(paths))
+	for _, path := range paths {
+		fileDescriptor, err := files.FindFileByPath(path)
+		if err != nil {
+			return nil, err
+		}
+		pkg := string(fileDescriptor.Package())
+		packageFiles[pkg] = append(packageFiles[pkg], fileDescriptor.Path())
+		fileDescriptors = append(fileDescriptors, fileDescriptor)
+	}
+	names := namer.New(opts.naming)
+	entries, err := collectFiles(names, fileDescriptors)
+	if err != nil {
+		return nil, err
+	}
+	// Under referenced, each file's mapping also lists the types of other
+	// files its fields use, which are entered once.
+	var references [][]string
+	if opts.referenced {
+		entries, references = appendReferenced(names, entries, fileDescriptors)
+	}
+	if err := checkEscapes(entries); err != nil {
+		return nil, err
+	}
+	resp := pluginpb.CodeGeneratorResponse{SupportedFeatures: proto.Uint64(supportedFeatures)}
+	collisions := findCollisions(entries)
+	if opts.validateOnly {
+		// Collisions fail validation even under collision_mode=suffix,
+		// which would only hide them.
+		if len(collisions) > 0 {
+			return nil, collisionError(collisions)
+		}
+		return &resp, nil
+	}
+	var renames []rename
+	if opts.collisionSuffix {
+		renames = suffixCollisions(entries)
+		collisions = findCollisions(entries)
+	}
+	if len(collisions) > 0 && opts.strict {
+		return nil, collisionError(collisions)
+	}
+	if opts.singleFile {
+		content, err := renderMapping(entries, collisions, renames, fileDescriptors, req.GetCompilerVersion())
+		if err != nil {
+			return nil, err
+		}
+		resp.File = outputFiles(outputFileName(), content)
+		unchanged, err := matchesBaseline(resp.File[0].GetContent())
+		if err != nil {
+			return nil, err
+		}
+		if unchanged {
+			resp.File = nil
+		}
 	} else {
-		return relativeName
+		// Files that declare nothing get no mapping file rather than an
+		// empty one.
+		for i, file := range fileDescriptors {
+			fileEntries := entriesOfFile(entries, file.Path())
+			if len(fileEntries) == 0 {
+				continue
+			}
+			if references != nil {
+				fileEntries = append(fileEntries, entriesWithKeys(entries, references[i])...)
+			}
+			content, err := renderMapping(fileEntries, collisionsOf(collisions, fileEntries), renamesOf(renames, fileEntries),
+				[]protoreflect.FileDescriptor{file}, req.GetCompilerVersion())
+			if err != nil {
+				return nil, err
+			}
+			resp.File = append(resp.File, outputFiles(perFileName(file.Path()), content)...)
+		}
 	}
+	if opts.reverse {
+		reverse := new(strings.Builder)
+		writeReverse(&lineWriter{w: reverse}, entries)
+		resp.File = append(resp.File, &pluginpb.CodeGeneratorResponse_File{
+			Name: proto.String("reverse.txt"), Content: proto.String(reverse.String())})
+	}
+	if opts.emitSchema {
+		schema := new(strings.Builder)
+		if err := writeSchema(&lineWriter{w: schema}); err != nil {
+			return nil, err
+		}
+		resp.File = append(resp.File, &pluginpb.CodeGeneratorResponse_File{
+			Name: proto.String("mapper.schema.json"), Content: proto.String(schema.String())})
+	}
+	if opts.packageIndex {
+		index := new(strings.Builder)
+		writePackageIndex(&lineWriter{w: index}, packageFiles)
+		resp.File = append(resp.File, &pluginpb.CodeGeneratorResponse_File{
+			Name: proto.String("package_index.txt"), Content: proto.String(index.String())})
+	}
+	return &resp, nil
 }
 
-func relativeNameOfMessage(message protoreflect.MessageDescriptor) string {
-	if _, ok := message.Parent().(protoreflect.MessageDescriptor); ok {
-		return sanitizeMessage(string(message.Name()))
-	} else {
-		prefix := typePrefix(message.ParentFile())
-		return sanitizeMessage(prefix + string(message.Name()))
+// renderMapping writes the mapping of entries declared in sources, preceded
+// in text output by a header naming the plugin, protoc, the number of sources
+// and, per file, the syntax, and by notes on omitted map entries, collisions
+// and renames. The plugin version is only written under stamp, so that by
+// default the output stays the same across plugin versions.
+func renderMapping(entries []entry, collisions []collision, renames []rename,
+	sources []protoreflect.FileDescriptor, compilerVersion *pluginpb.Version) (string, error) {
+	buf := new(strings.Builder)
+	writer := &lineWriter{w: buf}
+	if opts.verbose {
+		writer.w = io.MultiWriter(buf, os.Stderr)
 	}
+	if opts.format == "text" {
+		if opts.stamp {
+			writer.writeLine("# " + pluginName + " " + pluginVersion)
+		} else {
+			writer.writeLine("# " + pluginName)
+		}
+		if compilerVersion != nil {
+			writer.writeLine("# protoc " + formatVersion([]int{int(compilerVersion.GetMajor()),
+				int(compilerVersion.GetMinor()), int(compilerVersion.GetPatch())}))
+		} else {
+			writer.writeLine("# protoc version unknown")
+		}
+		writer.writeLine("# source protos: " + strconv.Itoa(len(sources)))
+		// Only a per-file mapping has a single syntax to note. Editions
+		// files never get here: checkEditions rejects them.
+		// textHeaderLength counts these lines.
+		if !opts.singleFile {
+			writer.writeLine("# syntax: " + sources[0].Syntax().String())
+		}
+	}
+	if opts.format == "text" && !opts.includeMapEntries && hasMapEntries(sources) {
+		writer.writeLine("# Map entry messages are omitted: SwiftProtobuf generates no type for them.")
+	}
+	if len(collisions) > 0 {
+		if opts.format == "text" {
+			writeCollisions(writer, collisions, "# ")
+		} else {
+			writeCollisions(&lineWriter{w: os.Stderr}, collisions, "warning: ")
+		}
+	}
+	if len(renames) > 0 {
+		if opts.format == "text" {
+			writeRenames(writer, renames, "# ")
+		} else {
+			writeRenames(&lineWriter{w: os.Stderr}, renames, "note: ")
+		}
+	}
+	if err := writeEntries(writer, entries); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
 }
 
-func fullNameOfEnum(enum protoreflect.EnumDescriptor) string {
-	relativeName := relativeNameOfEnum(enum)
-	if container, ok := enum.Parent().(protoreflect.MessageDescriptor); ok {
-		return fullNameOfMessage(container) + "." + relativeName
-	} else {
-		return relativeName
+// entriesOfFile returns the entries declared in the file at path.
+func entriesOfFile(entries []entry, path string) []entry {
+	var fileEntries []entry
+	for _, e := range entries {
+		if e.file == path {
+			fileEntries = append(fileEntries, e)
+		}
 	}
+	return fileEntries
 }
 
-func relativeNameOfEnum(enum protoreflect.EnumDescriptor) string {
-	if _, ok := enum.Parent().(protoreflect.MessageDescriptor); ok {
-		return sanitizeEnum(string(enum.Name()))
-	} else {
-		prefix := typePrefix(enum.ParentFile())
-		return sanitizeMessage(prefix + string(enum.Name()))
+// entriesWithKeys returns the entries listed under keys, in the order of
+// keys.
+func entriesWithKeys(entries []entry, keys []string) []entry {
+	byKey := make(map[string]entry, len(entries))
+	for _, e := range entries {
+		byKey[e.protoName] = e
+	}
+	keyEntries := make([]entry, 0, len(keys))
+	for _, key := range keys {
+		keyEntries = append(keyEntries, byKey[key])
 	}
+	return keyEntries
 }
 
-func fullNameOfOneof(oneof protoreflect.OneofDescriptor) string {
-	return fullNameOfMessage(oneof.Parent().(protoreflect.MessageDescriptor)) + "." + relativeNameOfOneof(oneof)
+// checkEscapes fails under fail_on_escape when any proto name had characters
+// that namer.Transform could only represent as _u<codepoint> escapes. Behind
+// protoc this never fires: protodesc already refuses such names when the
+// request is read, e.g. with "invalid nested name", and respond reports it
+// instead. The check only guards against protodesc accepting more names.
+func checkEscapes(entries []entry) error {
+	if !opts.failOnEscape {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if e.escaped {
+			names = append(names, e.protoName)
+		}
+	}
+	if len(names) > 0 {
+		return fmt.Errorf("proto names require escaping: %s", strings.Join(names, ", "))
+	}
+	return nil
 }
 
-func relativeNameOfOneof(oneof protoreflect.OneofDescriptor) string {
-	camelCase := toUpperCamelCase(string(oneof.Name()))
-	return sanitizeOneof("OneOf_" + camelCase)
+// matchesBaseline reports whether skip_unchanged is set and content equals the
+// baseline file. protoc only writes the files listed in the response, so
+// leaving the mapping out keeps the existing file and its timestamp intact.
+func matchesBaseline(content string) (bool, error) {
+	if !opts.skipUnchanged {
+		return false, nil
+	}
+	baseline, err := os.ReadFile(opts.baseline)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return string(baseline) == content, nil
 }
 
-func sanitizeMessage(name string) string {
-	return sanitizeTypeName(name, "Message")
+func checkCompilerVersion(version *pluginpb.Version) error {
+	if len(opts.minProtoc) == 0 {
+		return nil
+	}
+	if version == nil {
+		return fmt.Errorf("protoc did not report its version, min_protoc requires at least %s", formatVersion(opts.minProtoc))
+	}
+	actual := []int{int(version.GetMajor()), int(version.GetMinor()), int(version.GetPatch())}
+	for i, want := range opts.minProtoc {
+		if actual[i] > want {
+			return nil
+		} else if actual[i] < want {
+			return fmt.Errorf("protoc %s is older than min_protoc %s", formatVersion(actual), formatVersion(opts.minProtoc))
+		}
+	}
+	return nil
 }
 
-func sanitizeEnum(name string) string {
-	return sanitizeTypeName(name, "Enum")
+func formatVersion(version []int) string {
+	parts := make([]string, len(version))
+	for i, n := range version {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
 }
 
-func sanitizeOneof(name string) string {
-	return sanitizeTypeName(name, "Oneof")
+// collectFiles names the entities of each file on a pool of runtime.NumCPU()
+// workers. Results are concatenated in file order, so the output does not
+// depend on scheduling.
+func collectFiles(n *namer.Namer, files []protoreflect.FileDescriptor) ([]entry, error) {
+	results := make([][]entry, len(files))
+	errs := make([]error, len(files))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i], errs[i] = collectFile(n, files[i])
+			}
+		}()
+	}
+	for i := range files {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	var entries []entry
+	for i := range files {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		for _, e := range results[i] {
+			e.file = files[i].Path()
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
 }
 
-func sanitizeTypeName(name, disambiguator string) string {
-	if _, ok := reservedNames[name]; ok {
-		return name + disambiguator
-	} else if isAllUnderscore(name) {
-		return name + disambiguator
-	} else if strings.HasSuffix(name, disambiguator) {
-		return sanitizeTypeName(name[:len(name)-len(disambiguator)], disambiguator) + disambiguator
+// collectFile names the entities of file with a Namer computing the type
+// prefix of file once, rather than for each top-level type.
+func collectFile(n *namer.Namer, file protoreflect.FileDescriptor) ([]entry, error) {
+	n = n.ForFile(file)
+	var entries []entry
+	messages := file.Messages()
+	for i := 0; i < messages.Len(); i++ {
+		message := messages.Get(i)
+		var err error
+		entries, err = collectMessage(n, entries, message)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return name
+	enums := file.Enums()
+	for i := 0; i < enums.Len(); i++ {
+		enum := enums.Get(i)
+		var err error
+		entries, err = collectEnum(n, entries, enum)
+		if err != nil {
+			return nil, err
+		}
+	}
+	services := file.Services()
+	for i := 0; i < services.Len(); i++ {
+		service := services.Get(i)
+		var err error
+		entries, err = collectService(n, entries, service)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
 }
 
-func isAllUnderscore(name string) bool {
-	if len(name) == 0 {
-		return false
+func collectMessage(n *namer.Namer, entries []entry, message protoreflect.MessageDescriptor) ([]entry, error) {
+	// SwiftProtobuf turns map fields into Swift dictionaries and generates no
+	// type for the synthetic FooEntry message, so its name is only emitted on
+	// request and does not correspond to a real Swift type.
+	if message.IsMapEntry() && !opts.includeMapEntries {
+		return entries, nil
 	}
-	for _, s := range name {
-		if s != '_' {
-			return false
+	// Under skip_deprecated a deprecated message is left out together with
+	// everything nested in it, deprecated or not.
+	if opts.skipDeprecated && message.Options().(*descriptorpb.MessageOptions).GetDeprecated() {
+		return entries, nil
+	}
+	entries = append(entries, messageEntry(n, message))
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		entries = append(entries, fieldEntry(n, field))
+	}
+	if opts.fieldMaskPaths {
+		entries = appendFieldPaths(n, entries, message)
+	}
+	oneofs := message.Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		oneof := oneofs.Get(i)
+		// proto3 optional fields live in a synthetic oneof, but SwiftProtobuf
+		// generates a plain optional property for them and no OneOf_ enum.
+		if oneof.IsSynthetic() {
+			continue
+		}
+		swiftName, err := n.FullNameOfOneof(oneof)
+		if err != nil {
+			return nil, err
+		}
+		e := newEntry(n, oneofKind, oneof, swiftName)
+		_, e.escaped = n.TransformEscaping(string(oneof.Name()), true)
+		entries = append(entries, e)
+		// Each member field is also a case of the OneOf_ enum, named like
+		// the field's property.
+		members := oneof.Fields()
+		for j := 0; j < members.Len(); j++ {
+			field := members.Get(j)
+			c := newEntry(n, oneofCaseKind, field, swiftName+opts.naming.Separator+n.RelativeNameOfField(field))
+			c.protoName = entryKey(oneof) + "." + string(field.Name())
+			_, c.escaped = n.TransformEscaping(string(field.Name()), false)
+			entries = append(entries, c)
 		}
 	}
-	return true
+	nestMessages := message.Messages()
+	for i := 0; i < nestMessages.Len(); i++ {
+		msg := nestMessages.Get(i)
+		var err error
+		entries, err = collectMessage(n, entries, msg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	nestEnums := message.Enums()
+	for i := 0; i < nestEnums.Len(); i++ {
+		nestEnum := nestEnums.Get(i)
+		var err error
+		entries, err = collectEnum(n, entries, nestEnum)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
 }
 
-func typePrefix(file protoreflect.FileDescriptor) string {
-	return typePrefixInternal(string(file.Package()), file.Options().(*descriptorpb.FileOptions))
+// appendFieldPaths appends an entry for each FieldMask path of message with
+// two or more segments, such as a.b for field b of message field a, mapping
+// it to the chain of Swift property names. Single segments are the field
+// entries. As FieldMask paths can't index into repeated fields, paths go
+// through singular message fields only, and they stop before a message
+// already on the path.
+func appendFieldPaths(n *namer.Namer, entries []entry, message protoreflect.MessageDescriptor) []entry {
+	onPath := map[protoreflect.FullName]bool{message.FullName(): true}
+	var walk func(field protoreflect.FieldDescriptor, protoName, swiftName string)
+	walk = func(field protoreflect.FieldDescriptor, protoName, swiftName string) {
+		if field.Message() == nil || field.Cardinality() == protoreflect.Repeated || onPath[field.Message().FullName()] {
+			return
+		}
+		onPath[field.Message().FullName()] = true
+		fields := field.Message().Fields()
+		for i := 0; i < fields.Len(); i++ {
+			next := fields.Get(i)
+			path := swiftName + opts.naming.Separator + n.RelativeNameOfField(next)
+			e := newEntry(n, fieldPathKind, next, path)
+			e.protoName = protoName + "." + string(next.Name())
+			entries = append(entries, e)
+			walk(next, e.protoName, path)
+		}
+		delete(onPath, field.Message().FullName())
+	}
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		walk(field, entryKey(field), n.FullNameOfField(field))
+	}
+	return entries
 }
 
-func typePrefixInternal(packageName string, options *descriptorpb.FileOptions) string {
-	swiftPrefix := options.GetSwiftPrefix()
-	if len(swiftPrefix) > 0 {
-		return swiftPrefix
+// messageEntry builds the entry for message itself, with the columns the
+// options add to messages.
+func messageEntry(n *namer.Namer, message protoreflect.MessageDescriptor) entry {
+	var extra []string
+	if opts.protoMessageName {
+		extra = append(extra, protoMessageName(message))
 	}
-	if len(packageName) == 0 {
-		return ""
+	if opts.initialization {
+		extra = append(extra, strconv.FormatBool(hasRequiredFields(message, make(map[protoreflect.FullName]bool))))
 	}
-	ret := make([]rune, 0, len(packageName)+1)
-	makeUpper := true
-	for _, c := range packageName {
-		if c == '_' {
-			makeUpper = true
-		} else if c == '.' {
-			makeUpper = true
-			ret = append(ret, '_')
-		} else {
-			if len(ret) == 0 && unicode.IsNumber(c) {
-				ret = append(ret, '_')
-			}
-			if makeUpper {
-				ret = append(ret, unicode.ToUpper(c))
-				makeUpper = false
-			} else {
-				ret = append(ret, c)
-			}
-		}
+	if opts.fieldOrder {
+		extra = append(extra, fieldOrder(n, message))
 	}
-	ret = append(ret, '_')
-	return string(ret)
+	return newEntry(n, messageKind, message, n.FullNameOfMessage(message), extra...)
 }
 
-func toUpperCamelCase(name string) string {
-	return transform(name, true)
+// fieldEntry is messageEntry for fields.
+func fieldEntry(n *namer.Namer, field protoreflect.FieldDescriptor) entry {
+	var extra []string
+	if opts.accessorNames {
+		if has, clear, ok := n.AccessorNamesOfField(field); ok {
+			extra = append(extra, has, clear)
+		} else {
+			extra = append(extra, "-", "-")
+		}
+	}
+	if opts.protoFieldTypes {
+		extra = append(extra, protoFieldType(field))
+	}
+	e := newEntry(n, fieldKind, field, n.FullNameOfField(field), extra...)
+	_, e.escaped = n.TransformEscaping(string(field.Name()), false)
+	return e
 }
 
-var appreviations = map[string]bool{
-	"url":   true,
-	"http":  true,
-	"https": true,
-	"id":    true,
+// protoFieldType returns the proto full name of the message or enum type of
+// field, or "-" for scalars. Map fields are written as map<key,value>, with
+// the kind of scalar keys and values.
+func protoFieldType(field protoreflect.FieldDescriptor) string {
+	if field.IsMap() {
+		return "map<" + field.MapKey().Kind().String() + "," + protoValueType(field.MapValue()) + ">"
+	}
+	if field.Message() == nil && field.Enum() == nil {
+		return "-"
+	}
+	return protoValueType(field)
 }
 
-type CharKind int
-
-const (
-	digit CharKind = iota
-	lower
-	upper
-	underscore
-	other
-)
-
-func toCharKind(c rune) CharKind {
+func protoValueType(field protoreflect.FieldDescriptor) string {
 	switch {
-	case c >= '0' && c <= '9':
-		return digit
-	case c >= 'a' && c <= 'z':
-		return lower
-	case c >= 'A' && c <= 'Z':
-		return upper
-	case c == '_':
-		return underscore
-	default:
-		return other
+	case field.Message() != nil:
+		return string(field.Message().FullName())
+	case field.Enum() != nil:
+		return string(field.Enum().FullName())
 	}
+	return field.Kind().String()
 }
 
-func transform(name string, initialUpperCase bool) string {
-	result := new(strings.Builder)
-	var current []rune
-	lastKind := other
+// fieldOrder lists the fields of message in declaration order as
+// number:swiftName pairs, e.g. 3:id,1:name, or "-" when it has none.
+func fieldOrder(n *namer.Namer, message protoreflect.MessageDescriptor) string {
+	fields := message.Fields()
+	if fields.Len() == 0 {
+		return "-"
+	}
+	pairs := make([]string, fields.Len())
+	for i := range pairs {
+		field := fields.Get(i)
+		pairs[i] = strconv.Itoa(int(field.Number())) + ":" + n.RelativeNameOfField(field)
+	}
+	return strings.Join(pairs, ",")
+}
 
-	addCurrent := func() {
-		if len(current) == 0 {
-			return
+// hasMapEntries reports whether any of files declares a map field, whose
+// synthetic entry message collectMessage skips.
+func hasMapEntries(files []protoreflect.FileDescriptor) bool {
+	var walk func(messages protoreflect.MessageDescriptors) bool
+	walk = func(messages protoreflect.MessageDescriptors) bool {
+		for i := 0; i < messages.Len(); i++ {
+			message := messages.Get(i)
+			if message.IsMapEntry() || walk(message.Messages()) {
+				return true
+			}
 		}
-		currentAsString := string(current)
-		if result.Len() == 0 && !initialUpperCase {
-			// Nothing, want it to stay lowercase.
-		} else if _, ok := appreviations[currentAsString]; ok {
-			currentAsString = strings.ToUpper(currentAsString)
-		} else {
-			currentAsString = uppercaseFirstCharacter(currentAsString)
+		return false
+	}
+	for _, file := range files {
+		if walk(file.Messages()) {
+			return true
 		}
-		result.WriteString(currentAsString)
-		current = current[:0]
 	}
+	return false
+}
 
-	for _, c := range name {
-		kind := toCharKind(c)
-		switch kind {
-		case digit:
-			if lastKind != digit {
-				addCurrent()
-			}
-			if result.Len() == 0 {
-				result.WriteRune('_')
-			}
-			current = append(current, c)
+// newEntry builds the entry for desc, adding after extra the columns every
+// kind shares, and the naming steps stats counts. The Swift name is qualified
+// under module, and with_source puts the path of the declaring file right
+// after it.
+func newEntry(n *namer.Namer, kind entryKind, desc protoreflect.Descriptor, swiftName string, extra ...string) entry {
+	var ancestry []string
+	if opts.ancestry {
+		ancestry = ancestryOf(n, desc)
+	}
+	var slug string
+	if opts.slug {
+		slug = slugOf(desc)
+	}
+	e := entryWithColumns(kind, desc, swiftName, ancestry, slug, extra)
+	// A oneof case or field path repeats the naming of its field, which is
+	// counted on its own.
+	if opts.stats && kind != oneofCaseKind && kind != fieldPathKind {
+		e.steps = stepsOf(n, desc)
+	}
+	return e
+}
 
-		case upper:
-			if lastKind != upper {
-				addCurrent()
-			}
-			current = append(current, unicode.ToLower(c))
+// entryWithColumns is newEntry with the ancestry and slug columns given.
+func entryWithColumns(kind entryKind, desc protoreflect.Descriptor, swiftName string, ancestry []string, slug string, extra []string) entry {
+	e := entry{kind: kind, protoName: entryKey(desc), swiftName: qualified(swiftName), extra: extra}
+	if opts.withSource {
+		e.extra = append([]string{desc.ParentFile().Path()}, extra...)
+	}
+	if opts.ancestry {
+		e.ancestry = ancestry
+		e.extra = append(e.extra, strings.Join(ancestry, "/"))
+	}
+	if opts.moduleMap != nil {
+		e.extra = append(e.extra, moduleOf(desc))
+	}
+	if opts.slug {
+		e.extra = append(e.extra, slug)
+	}
+	return e
+}
 
-		case lower:
-			if lastKind != lower && lastKind != upper {
-				addCurrent()
-			}
-			current = append(current, c)
+// qualified prefixes swiftName with the module name set by module.
+func qualified(swiftName string) string {
+	if len(opts.module) > 0 {
+		return opts.module + opts.naming.Separator + swiftName
+	}
+	return swiftName
+}
 
-		case underscore:
-			addCurrent()
-			if lastKind == underscore {
-				result.WriteRune('_')
-			}
+// hasRequiredFields reports whether message, or any message reachable through
+// its message-typed fields, declares required fields. Those are the messages
+// SwiftProtobuf generates a non-trivial isInitialized for. visited breaks
+// cycles between recursive messages.
+func hasRequiredFields(message protoreflect.MessageDescriptor, visited map[protoreflect.FullName]bool) bool {
+	if visited[message.FullName()] {
+		return false
+	}
+	visited[message.FullName()] = true
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if field.Cardinality() == protoreflect.Required {
+			return true
+		}
+		if field.Message() != nil && hasRequiredFields(field.Message(), visited) {
+			return true
+		}
+	}
+	return false
+}
 
-		case other:
-			addCurrent()
-			escapeIt := false
-			if result.Len() == 0 {
-				escapeIt = !isSwiftIdentifierHeadCharacter(c)
-			} else {
-				escapeIt = !isSwiftIdentifierCharacter(c)
-			}
-			if escapeIt {
-				_, _ = fmt.Fprintf(result, "_u%d", c)
-			} else {
-				current = append(current, c)
-			}
+// protoMessageName is the value SwiftProtobuf generates for the message's
+// static protoMessageName property: the package-qualified proto name.
+func protoMessageName(message protoreflect.MessageDescriptor) string {
+	return string(message.FullName())
+}
 
-		default:
-			panic("can't reach here")
+func collectEnum(n *namer.Namer, entries []entry, enum protoreflect.EnumDescriptor) ([]entry, error) {
+	if opts.skipDeprecated && enum.Options().(*descriptorpb.EnumOptions).GetDeprecated() {
+		return entries, nil
+	}
+	entries = append(entries, enumEntry(n, enum))
+	values := enum.Values()
+	for i := 0; i < values.Len(); i++ {
+		value := values.Get(i)
+		swiftName, err := n.FullNameOfEnumValue(value)
+		if err != nil {
+			return nil, err
 		}
-
-		lastKind = kind
+		e := newEntry(n, enumValueKind, value, swiftName)
+		_, e.escaped = n.TransformEscaping(string(value.Name()), false)
+		entries = append(entries, e)
+	}
+	if opts.unrecognized && isOpenEnum(enum) {
+		entries = append(entries, unrecognizedEntry(n, enum))
 	}
-	// Add the last segment collected.
-	addCurrent()
+	return entries, nil
+}
 
-	// If things end in an underscore, add one also.
-	if lastKind == underscore {
-		result.WriteRune('_')
+// unrecognizedEntry is the entry of the UNRECOGNIZED(Int) case SwiftProtobuf
+// adds to open enums for unknown values. The case has no descriptor, so it
+// is keyed like a declared value and its columns extend the enum's.
+func unrecognizedEntry(n *namer.Namer, enum protoreflect.EnumDescriptor) entry {
+	var ancestry []string
+	if opts.ancestry {
+		ancestry = append(ancestryOf(n, enum), "UNRECOGNIZED")
+	}
+	var slug string
+	if opts.slug {
+		slug = slugOf(enum) + "-unrecognized"
 	}
+	e := entryWithColumns(enumValueKind, enum, n.FullNameOfEnum(enum)+opts.naming.Separator+"UNRECOGNIZED", ancestry, slug, nil)
+	e.protoName = entryKey(enum) + ".UNRECOGNIZED"
+	e.synthetic = true
+	return e
+}
 
-	return result.String()
+// enumEntry is messageEntry for enums.
+func enumEntry(n *namer.Namer, enum protoreflect.EnumDescriptor) entry {
+	var extra []string
+	if opts.enumOpenness {
+		if isOpenEnum(enum) {
+			extra = append(extra, "open")
+		} else {
+			extra = append(extra, "closed")
+		}
+	}
+	// The first declared value is the default of proto2 fields, whatever
+	// its number.
+	if opts.firstEnumValue {
+		extra = append(extra, n.RelativeNameOfEnumValue(enum.Values().Get(0)))
+	}
+	return newEntry(n, enumKind, enum, n.FullNameOfEnum(enum), extra...)
 }
 
-func uppercaseFirstCharacter(s string) string {
-	if len(s) == 0 {
-		return s
+// referencedTypes returns, for each of files, the messages and enums its
+// fields refer to that none of files declares, in order of first use. A map
+// field refers to its value type, never to the synthetic entry message.
+func referencedTypes(files []protoreflect.FileDescriptor) [][]protoreflect.Descriptor {
+	generated := make(map[string]bool, len(files))
+	for _, file := range files {
+		generated[file.Path()] = true
 	}
-	ret := []rune(s)
-	ret[0] = unicode.ToUpper(ret[0])
-	return string(ret)
+	references := make([][]protoreflect.Descriptor, len(files))
+	for i, file := range files {
+		seen := make(map[protoreflect.FullName]bool)
+		var walk func(messages protoreflect.MessageDescriptors)
+		walk = func(messages protoreflect.MessageDescriptors) {
+			for j := 0; j < messages.Len(); j++ {
+				message := messages.Get(j)
+				fields := message.Fields()
+				for k := 0; k < fields.Len(); k++ {
+					// Resolving through any map entry, not only those of
+					// map fields, keeps an entry from standing in for a
+					// real value type.
+					field := fields.Get(k)
+					if field.Message() != nil && field.Message().IsMapEntry() {
+						field = field.Message().Fields().ByName("value")
+					}
+					var desc protoreflect.Descriptor
+					if field.Message() != nil {
+						desc = field.Message()
+					} else if field.Enum() != nil {
+						desc = field.Enum()
+					}
+					if desc != nil && !generated[desc.ParentFile().Path()] && !seen[desc.FullName()] {
+						seen[desc.FullName()] = true
+						references[i] = append(references[i], desc)
+					}
+				}
+				walk(message.Messages())
+			}
+		}
+		walk(file.Messages())
+	}
+	return references
 }
 
-func isSwiftIdentifierHeadCharacter(c rune) bool {
-	switch {
-	case (c >= 0x61 && c <= 0x7a) || (c >= 0x41 && c <= 0x5a):
-		fallthrough
-	case c == 0x5f:
-		fallthrough
-	case (c == 0xa8) || (c == 0xaa) || (c == 0xad) || (c == 0xaf) || (c >= 0xb2 && c <= 0xb5) || (c >= 0xb7 && c <= 0xba):
-		fallthrough
-	case (c >= 0xbc && c <= 0xbe) || (c >= 0xc0 && c <= 0xd6) || (c >= 0xd8 && c <= 0xf6) || (c >= 0xf8 && c <= 0xff):
-		fallthrough
-	case (c >= 0x100 && c <= 0x2ff) || (c >= 0x370 && c <= 0x167f) || (c >= 0x1681 && c <= 0x180d) || (c >= 0x180f && c <= 0x1dbf):
-		fallthrough
-	case c >= 0x1e00 && c <= 0x1fff:
-		fallthrough
-	case (c >= 0x200b && c <= 0x200d) || (c >= 0x202a && c <= 0x202e) || (c == 0x203F) || (c == 0x2040) || (c == 0x2054) || (c >= 0x2060 && c <= 0x206f):
-		fallthrough
-	case (c >= 0x2070 && c <= 0x20cf) || (c >= 0x2100 && c <= 0x218f) || (c >= 0x2460 && c <= 0x24ff) || (c >= 0x2776 && c <= 0x2793):
-		fallthrough
-	case (c >= 0x2c00 && c <= 0x2dff) || (c >= 0x2e80 && c <= 0x2fff):
-		fallthrough
-	case (c >= 0x3004 && c <= 0x3007) || (c >= 0x3021 && c <= 0x302f) || (c >= 0x3031 && c <= 0x303f) || (c >= 0x3040 && c <= 0xd7ff):
-		fallthrough
-	case (c >= 0xf900 && c <= 0xfd3d) || (c >= 0xfd40 && c <= 0xfdcf) || (c >= 0xfdf0 && c <= 0xfe1f) || (c >= 0xfe30 && c <= 0xfe44):
-		fallthrough
-	case c >= 0xfe47 && c <= 0xfffd:
-		fallthrough
-	case (c >= 0x10000 && c <= 0x1fffd) || (c >= 0x20000 && c <= 0x2fffd) || (c >= 0x30000 && c <= 0x3fffd) || (c >= 0x40000 && c <= 0x4fffd):
-		fallthrough
-	case (c >= 0x50000 && c <= 0x5fffd) || (c >= 0x60000 && c <= 0x6fffd) || (c >= 0x70000 && c <= 0x7fffd) || (c >= 0x80000 && c <= 0x8fffd):
-		fallthrough
-	case (c >= 0x90000 && c <= 0x9fffd) || (c >= 0xa0000 && c <= 0xafffd) || (c >= 0xb0000 && c <= 0xbfffd) || (c >= 0xc0000 && c <= 0xcfffd):
-		fallthrough
-	case (c >= 0xd0000 && c <= 0xdfffd) || (c >= 0xe0000 && c <= 0xefffd):
-		return true
+// appendReferenced appends to entries an entry for each type referencedTypes
+// finds, once however many files refer to it, and returns the keys of the
+// types each of files refers to.
+func appendReferenced(n *namer.Namer, entries []entry, files []protoreflect.FileDescriptor) ([]entry, [][]string) {
+	keys := make([][]string, len(files))
+	added := make(map[string]bool)
+	for i, references := range referencedTypes(files) {
+		for _, desc := range references {
+			key := entryKey(desc)
+			keys[i] = append(keys[i], key)
+			if added[key] {
+				continue
+			}
+			added[key] = true
+			var e entry
+			switch d := desc.(type) {
+			case protoreflect.MessageDescriptor:
+				e = messageEntry(n, d)
+			case protoreflect.EnumDescriptor:
+				e = enumEntry(n, d)
+			}
+			e.file = desc.ParentFile().Path()
+			entries = append(entries, e)
+		}
+	}
+	return entries, keys
+}
 
-	default:
-		return false
+// collectService emits the service with the client and provider protocol
+// names grpc-swift generates for it, then each method with its streaming
+// direction and, with method_types, its input and output Swift types.
+func collectService(n *namer.Namer, entries []entry, service protoreflect.ServiceDescriptor) ([]entry, error) {
+	swiftName := n.RelativeNameOfService(service)
+	entries = append(entries, newEntry(n, serviceKind, service, swiftName, qualified(swiftName+"Client"), qualified(swiftName+"Provider")))
+	methods := service.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		method := methods.Get(i)
+		extra := []string{streamingKind(method)}
+		if opts.methodTypes {
+			extra = append(extra, qualified(n.FullNameOfMessage(method.Input())), qualified(n.FullNameOfMessage(method.Output())))
+		}
+		swiftName, err := n.FullNameOfMethod(method)
+		if err != nil {
+			return nil, err
+		}
+		e := newEntry(n, methodKind, method, swiftName, extra...)
+		_, e.escaped = n.TransformEscaping(string(method.Name()), false)
+		entries = append(entries, e)
 	}
+	return entries, nil
 }
 
-func isSwiftIdentifierCharacter(c rune) bool {
+// streamingKind names the RPC shape of method, which decides the async
+// signature grpc-swift generates for it.
+func streamingKind(method protoreflect.MethodDescriptor) string {
 	switch {
-	case c >= 0x30 && c <= 0x39:
-		fallthrough
-	case (c >= 0x300 && c <= 0x36F) || (c >= 0x1dc0 && c <= 0x1dff) || (c >= 0x20d0 && c <= 0x20ff) || (c >= 0xfe20 && c <= 0xfe2f):
-		return true
-
+	case method.IsStreamingClient() && method.IsStreamingServer():
+		return "bidi"
+	case method.IsStreamingClient():
+		return "client-stream"
+	case method.IsStreamingServer():
+		return "server-stream"
 	default:
-		return isSwiftIdentifierHeadCharacter(c)
+		return "unary"
 	}
 }
 
-var reservedNames = map[string]bool{
-	"SwiftProtobuf":    true,
-	"Extensions":       true,
-	"protoMessageName": true,
-	"decodeMessage":    true,
-	"traverse":         true,
-	"isInitialized":    true,
-	"unknownFields":    true,
-	"debugDescription": true,
-	"description":      true,
-	"dynamicType":      true,
-	"hashValue":        true,
-	"Type":             true,
-	"Protocol":         true,
-}
-
-var swiftKeywordsUsedInDeclarations = []string{
-	"associatedtype", "class", "deinit", "enum", "extension",
-	"fileprivate", "func", "import", "init", "inout", "internal",
-	"let", "open", "operator", "private", "protocol", "public",
-	"static", "struct", "subscript", "typealias", "var",
+// checkEditions refuses editions files up front. Naming them would need the
+// resolved features, e.g. enum_type for isOpenEnum, which the protobuf
+// runtime this builds against can't resolve. supportedFeatures doesn't
+// declare editions support, so a recent protoc refuses them before running
+// the plugin; this covers older ones and hand-built requests.
+func checkEditions(files []*descriptorpb.FileDescriptorProto) error {
+	for _, file := range files {
+		if file.GetSyntax() == "editions" {
+			return fmt.Errorf("%s: editions files are not supported", file.GetName())
+		}
+	}
+	return nil
 }
 
-var swiftKeywordsUsedInStatements = []string{
-	"break", "case",
-	"continue", "default", "defer", "do", "else", "fallthrough",
-	"for", "guard", "if", "in", "repeat", "return", "switch", "where",
-	"while",
+// isOpenEnum reports whether enum accepts unknown values, which SwiftProtobuf
+// models with an UNRECOGNIZED case. proto3 enums are open and proto2 enums
+// closed; checkEditions keeps editions files, whose enum_type feature would
+// decide, out.
+func isOpenEnum(enum protoreflect.EnumDescriptor) bool {
+	return enum.ParentFile().Syntax() == protoreflect.Proto3
 }
 
-var swiftKeywordsUsedInExpressionsAndTypes = []string{
-	"as",
-	"Any", "catch", "false", "is", "nil", "rethrows", "super", "self",
-	"Self", "throw", "throws", "true", "try",
+// entryKey is the key desc is listed under: its proto full name, qualified
+// by the path of the declaring file under key=file_and_name. Enum values are
+// keyed under their enum, foo.Color.COLOR_RED rather than protoc's
+// foo.COLOR_RED, as in Swift, so the values of an enum share its key as a
+// prefix, UNRECOGNIZED included.
+func entryKey(desc protoreflect.Descriptor) string {
+	if value, ok := desc.(protoreflect.EnumValueDescriptor); ok {
+		return entryKey(value.Parent()) + "." + string(value.Name())
+	}
+	if opts.keyWithFile {
+		return desc.ParentFile().Path() + "::" + string(desc.FullName())
+	}
+	return string(desc.FullName())
 }
 
-var swiftCommonTypes = []string{
-	"Bool", "Data", "Double", "Float", "Int",
-	"Int32", "Int64", "String", "UInt", "UInt32", "UInt64",
+// moduleOf returns the Swift module module_map assigns to desc's package, or
+// "-" when the package is not mapped so the column is never empty.
+func moduleOf(desc protoreflect.Descriptor) string {
+	if module, ok := opts.moduleMap[string(desc.ParentFile().Package())]; ok {
+		return module
+	}
+	return "-"
 }
 
-var swiftSpecialVariables = []string{
-	"__COLUMN__",
-	"__FILE__", "__FUNCTION__", "__LINE__",
+// slugOf derives a lowercase, hyphen-separated slug from desc's proto full
+// name, splitting at dots, underscores and lower-to-upper case changes, e.g.
+// foo.bar_baz.OuterType becomes foo-bar-baz-outer-type.
+func slugOf(desc protoreflect.Descriptor) string {
+	slug := new(strings.Builder)
+	lastKind := namer.Other
+	for _, c := range string(desc.FullName()) {
+		kind := namer.ToCharKind(c)
+		switch kind {
+		case namer.Lower, namer.Digit:
+			slug.WriteRune(c)
+		case namer.Upper:
+			if lastKind == namer.Lower || lastKind == namer.Digit {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(unicode.ToLower(c))
+		default:
+			if lastKind != namer.Other && lastKind != namer.Underscore {
+				slug.WriteByte('-')
+			}
+			kind = namer.Other
+		}
+		lastKind = kind
+	}
+	return strings.Trim(slug.String(), "-")
 }
 
-func init() {
-	for _, keyword := range swiftKeywordsUsedInDeclarations {
-		reservedNames[keyword] = true
-	}
-	for _, keyword := range swiftKeywordsUsedInStatements {
-		reservedNames[keyword] = true
-	}
-	for _, keyword := range swiftKeywordsUsedInExpressionsAndTypes {
-		reservedNames[keyword] = true
-	}
-	for _, commonType := range swiftCommonTypes {
-		reservedNames[commonType] = true
+// ancestryOf returns the Swift relative names of the enclosing types of
+// desc, outermost first, ending with desc itself.
+func ancestryOf(n *namer.Namer, desc protoreflect.Descriptor) []string {
+	var names []string
+	for d := desc; d != nil; d = d.Parent() {
+		switch d := d.(type) {
+		case protoreflect.MessageDescriptor:
+			names = append(names, n.RelativeNameOfMessage(d))
+		case protoreflect.EnumDescriptor:
+			names = append(names, n.RelativeNameOfEnum(d))
+		case protoreflect.OneofDescriptor:
+			names = append(names, n.RelativeNameOfOneof(d))
+		case protoreflect.FieldDescriptor:
+			names = append(names, n.RelativeNameOfField(d))
+		case protoreflect.EnumValueDescriptor:
+			names = append(names, n.RelativeNameOfEnumValue(d))
+		case protoreflect.ServiceDescriptor:
+			names = append(names, n.RelativeNameOfService(d))
+		case protoreflect.MethodDescriptor:
+			names = append(names, n.RelativeNameOfMethod(d))
+		}
 	}
-	for _, variable := range swiftSpecialVariables {
-		reservedNames[variable] = true
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
 	}
+	return names
 }
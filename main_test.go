@@ -0,0 +1,1692 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+
+	"github.com/ClarkGuan/protoc-gen-namer/namer"
+)
+
+// newRequest builds a request with parameter generating every file of the
+// FileDescriptorSet written in text format.
+func newRequest(t *testing.T, parameter, files string) *pluginpb.CodeGeneratorRequest {
+	set := new(descriptorpb.FileDescriptorSet)
+	if err := prototext.Unmarshal([]byte(files), set); err != nil {
+		t.Fatal(err)
+	}
+	req := &pluginpb.CodeGeneratorRequest{Parameter: proto.String(parameter), ProtoFile: set.File}
+	for _, file := range set.File {
+		req.FileToGenerate = append(req.FileToGenerate, file.GetName())
+	}
+	return req
+}
+
+// generateFiles runs generate on req and returns the content of each
+// response file by name.
+func generateFiles(t *testing.T, req *pluginpb.CodeGeneratorRequest) map[string]string {
+	resp, err := generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, file := range resp.File {
+		files[file.GetName()] = file.GetContent()
+	}
+	return files
+}
+
+// hasLines checks that the mapping content has each of lines as a whole line.
+func hasLines(t *testing.T, content string, lines ...string) {
+	t.Helper()
+	present := make(map[string]bool)
+	for _, line := range strings.Split(content, "\n") {
+		present[line] = true
+	}
+	for _, line := range lines {
+		if !present[line] {
+			t.Errorf("mapping lacks line %q:\n%s", line, content)
+		}
+	}
+}
+
+func TestParseParameters(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"format=json,stats", map[string]string{"format": "json", "stats": "true"}, false},
+		{"baseline=", map[string]string{"baseline": ""}, false},
+		{"out=a=b.txt", map[string]string{"out": "a=b.txt"}, false},
+		{"abbreviations=api,abbreviations=sql", map[string]string{"abbreviations": "api,sql"}, false},
+		{"abbreviations=api,slug", map[string]string{"abbreviations": "api", "slug": "true"}, false},
+		{"module_map=foo=Foo,module_map=stats=Stats", map[string]string{"module_map": "foo=Foo,stats=Stats"}, false},
+		{"module_map=foo=Foo,bar=Bar", nil, true},
+		{"a=b,,c=", nil, true},
+		{"format=json,,baseline=", nil, true},
+		{"stats,", nil, true},
+		{",stats", nil, true},
+		{"=json", nil, true},
+		{"format=json,format=csv", nil, true},
+		{"no_such_option=1", nil, true},
+	}
+	for _, test := range tests {
+		got, err := parseParameters(test.raw)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseParameters(%q) = %v, want an error", test.raw, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseParameters(%q) failed: %v", test.raw, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseParameters(%q) = %v, want %v", test.raw, got, test.want)
+		}
+	}
+}
+
+func TestRespondError(t *testing.T) {
+	req := newRequest(t, "", `
+		file {
+			name: "broken.proto"
+			package: "broken"
+			message_type {
+				name: "Broken"
+				field { name: "missing" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".broken.Missing" }
+			}
+		}
+	`)
+	resp := respond(req)
+	if len(resp.GetError()) == 0 {
+		t.Fatalf("respond returned no error for a malformed descriptor")
+	}
+	if len(resp.File) > 0 {
+		t.Errorf("respond returned files along with error %q", resp.GetError())
+	}
+	if resp.GetSupportedFeatures() != supportedFeatures {
+		t.Errorf("respond declared features %d with the error, want %d", resp.GetSupportedFeatures(), supportedFeatures)
+	}
+}
+
+// TestFailOnEscape shows what fail_on_escape gives for a hyphenated name:
+// the descriptor is refused before naming, so the error comes from protodesc.
+func TestFailOnEscape(t *testing.T) {
+	req := newRequest(t, "fail_on_escape", `
+		file {
+			name: "dash.proto"
+			package: "dash"
+			message_type {
+				name: "Dash"
+				field { name: "foo-bar" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+			}
+		}
+	`)
+	resp := respond(req)
+	if !strings.Contains(resp.GetError(), "foo-bar") || strings.Contains(resp.GetError(), "require escaping") {
+		t.Errorf("respond returned error %q, want protodesc refusing foo-bar", resp.GetError())
+	}
+}
+
+func TestMinProtoc(t *testing.T) {
+	version := func(major, minor, patch int32) *pluginpb.Version {
+		return &pluginpb.Version{Major: proto.Int32(major), Minor: proto.Int32(minor), Patch: proto.Int32(patch)}
+	}
+	tests := []struct {
+		version *pluginpb.Version
+		wantErr bool
+	}{
+		{version(3, 19, 4), true},
+		{version(3, 20, 99), true},
+		{version(3, 21, 0), false},
+		{version(3, 21, 12), false},
+		{version(4, 0, 0), false},
+		{nil, true},
+	}
+	for _, test := range tests {
+		req := newRequest(t, "min_protoc=3.21", `file { name: "a.proto" package: "a" message_type { name: "A" } }`)
+		req.CompilerVersion = test.version
+		_, err := generate(req)
+		if test.wantErr && err == nil {
+			t.Errorf("protoc %v passed min_protoc=3.21", test.version)
+		} else if !test.wantErr && err != nil {
+			t.Errorf("protoc %v failed min_protoc=3.21: %v", test.version, err)
+		}
+	}
+}
+
+// TestLineEnding feeds lines that already end in CRLF, as a Windows writer
+// path would produce, and checks the configured ending replaces them.
+func TestLineEnding(t *testing.T) {
+	tests := []struct {
+		parameter string
+		want      string
+	}{
+		{"line_ending=lf", "a b\nc\nd\n"},
+		{"line_ending=crlf", "a b\r\nc\r\nd\r\n"},
+	}
+	for _, test := range tests {
+		if err := parseOptions(test.parameter); err != nil {
+			t.Fatal(err)
+		}
+		buf := new(strings.Builder)
+		w := &lineWriter{w: buf}
+		w.writeLine("a", "b\r\n")
+		w.writeLine("c\n")
+		w.writeLine("d")
+		if buf.String() != test.want {
+			t.Errorf("%s wrote %q, want %q", test.parameter, buf.String(), test.want)
+		}
+	}
+}
+
+func TestLineEndingOutput(t *testing.T) {
+	req := newRequest(t, "line_ending=crlf,group_by=kind", `
+		file { name: "a.proto" package: "a" message_type { name: "A" field { name: "b" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 } } }
+	`)
+	resp, err := generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := resp.File[0].GetContent()
+	if strings.Count(content, "\n") != strings.Count(content, "\r\n") || !strings.HasSuffix(content, "\r\n") {
+		t.Errorf("line_ending=crlf wrote lines not ending in CRLF:\n%q", content)
+	}
+}
+
+// BenchmarkCollectFiles names a synthetic set of 100 files declaring 500
+// messages each, one file after the other and on collectFiles' worker pool.
+func BenchmarkCollectFiles(b *testing.B) {
+	var files []protoreflect.FileDescriptor
+	for i := 0; i < 100; i++ {
+		fileProto := &descriptorpb.FileDescriptorProto{
+			Name:    proto.String("large" + strconv.Itoa(i) + ".proto"),
+			Package: proto.String("company.product.large" + strconv.Itoa(i)),
+		}
+		for j := 0; j < 500; j++ {
+			fileProto.MessageType = append(fileProto.MessageType, &descriptorpb.DescriptorProto{
+				Name: proto.String("Message" + strconv.Itoa(j)),
+				Field: []*descriptorpb.FieldDescriptorProto{{
+					Name:   proto.String("some_field"),
+					Number: proto.Int32(1),
+					Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				}},
+			})
+		}
+		file, err := protodesc.NewFile(fileProto, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	if err := parseOptions(""); err != nil {
+		b.Fatal(err)
+	}
+	n := namer.New(opts.naming)
+	b.Run("Sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, file := range files {
+				if _, err := collectFile(n, file); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("Pool", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := collectFiles(n, files); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestStatsPerFile checks that each per-file mapping counts its own entries.
+func TestStatsPerFile(t *testing.T) {
+	req := newRequest(t, "stats", `
+		file {
+			name: "a.proto"
+			package: "a"
+			message_type {
+				name: "A"
+				field { name: "first_name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+				field { name: "last_name" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+				field { name: "self" number: 3 label: LABEL_OPTIONAL type: TYPE_STRING }
+			}
+			enum_type { name: "Kind" value { name: "KIND_UNKNOWN" number: 0 } }
+		}
+		file {
+			name: "b.proto"
+			package: "b"
+			message_type {
+				name: "B"
+				field { name: "id" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+			}
+		}
+	`)
+	files := generateFiles(t, req)
+	tests := []struct {
+		file  string
+		stats string
+	}{
+		{"a.namer.txt", "# camel-cased: 3\n# prefixed: 2\n# disambiguated: 1\n# enum values: 1\n"},
+		{"b.namer.txt", "# camel-cased: 0\n# prefixed: 1\n# disambiguated: 0\n# enum values: 0\n"},
+	}
+	for _, test := range tests {
+		if !strings.HasSuffix(files[test.file], test.stats) {
+			t.Errorf("%s ends with stats\n%s\nwant\n%s", test.file, files[test.file], test.stats)
+		}
+	}
+}
+
+// TestStatsSteps checks the naming steps counted for messages named under
+// case=lower or by a name_option override.
+// TestBufPaths checks that per-file outputs follow the path of their source
+// whether it is module-relative, as from buf, or workspace-relative.
+func TestBufPaths(t *testing.T) {
+	req := newRequest(t, "", `
+		file {
+			name: "buf.build/org/repo/foo.proto"
+			package: "foo"
+			message_type { name: "Bar" }
+		}
+		file {
+			name: "local/foo.proto"
+			package: "local"
+			message_type { name: "Baz" }
+		}
+	`)
+	files := generateFiles(t, req)
+	if len(files) != 2 {
+		t.Errorf("generated %d files, want 2", len(files))
+	}
+	hasLines(t, files["buf.build/org/repo/foo.namer.txt"], "foo.Bar Foo_Bar")
+	hasLines(t, files["local/foo.namer.txt"], "local.Baz Local_Baz")
+}
+
+func TestGroupByKind(t *testing.T) {
+	req := newRequest(t, "group_by=kind,single_file", `
+		file {
+			name: "zoo.proto"
+			package: "zoo"
+			message_type {
+				name: "Keeper"
+				field { name: "a" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+				oneof_decl { name: "shift" }
+			}
+			message_type { name: "Animal" }
+			enum_type { name: "Diet" value { name: "DIET_UNKNOWN" number: 0 } }
+			enum_type { name: "Area" value { name: "AREA_UNKNOWN" number: 0 } }
+		}
+	`)
+	content := generateFiles(t, req)["mapper.txt"]
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")[textHeaderLength():]
+	want := []string{
+		"# Messages",
+		"zoo.Animal Zoo_Animal",
+		"zoo.Keeper Zoo_Keeper",
+		"# Enums",
+		"zoo.Area Zoo_Area",
+		"zoo.Diet Zoo_Diet",
+		"# Oneofs",
+		"zoo.Keeper.shift Zoo_Keeper.OneOf_Shift",
+		"# Oneof Cases",
+		"zoo.Keeper.shift.a Zoo_Keeper.OneOf_Shift.a",
+		"# Fields",
+		"zoo.Keeper.a Zoo_Keeper.a",
+		"# Field Paths",
+		"# Enum Values",
+		"zoo.Area.AREA_UNKNOWN Zoo_Area.unknown",
+		"zoo.Diet.DIET_UNKNOWN Zoo_Diet.unknown",
+		"# Services",
+		"# Methods",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("group_by=kind mapping is\n%s\nwant the sections\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	const files = `
+		file {
+			name: "zoo.proto"
+			package: "zoo"
+			message_type { name: "Animal" }
+		}
+	`
+	content := generateFiles(t, newRequest(t, "single_file", files))["mapper.txt"]
+	baseline := filepath.Join(t.TempDir(), "mapper.txt")
+	tests := []struct {
+		baseline string
+		want     int
+	}{
+		{content, 0},
+		{content + "zoo.Keeper Zoo_Keeper\n", 1},
+	}
+	for _, test := range tests {
+		if err := os.WriteFile(baseline, []byte(test.baseline), 0644); err != nil {
+			t.Fatal(err)
+		}
+		req := newRequest(t, "skip_unchanged,single_file,baseline="+baseline, files)
+		generated := generateFiles(t, req)
+		if len(generated) != test.want {
+			t.Errorf("skip_unchanged with baseline\n%s\ngenerated %d files, want %d", test.baseline, len(generated), test.want)
+		}
+		if test.want > 0 && generated["mapper.txt"] != content {
+			t.Errorf("skip_unchanged generated\n%s\nwant\n%s", generated["mapper.txt"], content)
+		}
+	}
+}
+
+// escapeNames are proto names made up to exercise the escaping of the
+// formats, as the plugin never sees them from protoc.
+var escapeNames = []string{
+	"a.B",
+	`quote"back\slash`,
+	"tab\tnew\nline\rreturn",
+	"nul\x00del\x7f\x01",
+	"key=value:colon #hash !bang",
+	" leading space",
+	"pipe|cell",
+	"é🙂",
+}
+
+func escapeEntries() []entry {
+	var entries []entry
+	for _, name := range escapeNames {
+		entries = append(entries, entry{kind: messageKind, protoName: name, swiftName: "Swift " + name})
+	}
+	return entries
+}
+
+// parseSwiftString reads the Swift string literal s starts with and returns
+// its value and the rest of s.
+func parseSwiftString(s string) (string, string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", "", fmt.Errorf("no string literal at %q", s)
+	}
+	b := new(strings.Builder)
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			return b.String(), s[i+1:], nil
+		case c < 0x20 || c == 0x7f:
+			return "", "", fmt.Errorf("unescaped control character %q in %q", c, s)
+		case c != '\\':
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(s) {
+			break
+		}
+		switch s[i] {
+		case '\\', '"':
+			b.WriteByte(s[i])
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '0':
+			b.WriteByte(0)
+		case 'u':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 || s[i+1] != '{' {
+				return "", "", fmt.Errorf("malformed \\u escape in %q", s)
+			}
+			code, err := strconv.ParseUint(s[i+2:i+end], 16, 32)
+			if err != nil {
+				return "", "", err
+			}
+			b.WriteRune(rune(code))
+			i += end
+		default:
+			return "", "", fmt.Errorf("unknown escape \\%c in %q", s[i], s)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string literal %q", s)
+}
+
+// TestSwiftDict parses the swiftdict output back as a Swift dictionary
+// literal of string keys and values.
+func TestSwiftDict(t *testing.T) {
+	if err := parseOptions("format=swiftdict"); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(strings.Builder)
+	writeSwiftDict(&lineWriter{w: buf}, escapeEntries())
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if lines[0] != "let protoNameMap: [String: String] = [" || lines[len(lines)-1] != "]" {
+		t.Fatalf("swiftdict output is not a dictionary literal:\n%s", buf.String())
+	}
+	got := make(map[string]string)
+	for _, line := range lines[1 : len(lines)-1] {
+		key, rest, err := parseSwiftString(strings.TrimPrefix(line, "    "))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(rest, ": ") {
+			t.Fatalf("no colon after the key of %q", line)
+		}
+		value, rest, err := parseSwiftString(rest[2:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rest != "," {
+			t.Fatalf("no comma after the value of %q", line)
+		}
+		got[key] = value
+	}
+	want := make(map[string]string)
+	for _, e := range escapeEntries() {
+		want[e.protoName] = e.swiftName
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("swiftdict output parses to %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	writeSwiftDict(&lineWriter{w: buf}, nil)
+	if want := "let protoNameMap: [String: String] = [:]\n"; buf.String() != want {
+		t.Errorf("swiftdict output without entries is %q, want %q", buf.String(), want)
+	}
+}
+
+// parseProperty reads a line of a .properties file the way
+// java.util.Properties.load does, for lines that don't continue.
+func parseProperty(line string) (string, string, error) {
+	line = strings.TrimLeft(line, " \t\f")
+	end := 0
+	for end < len(line) && !strings.ContainsRune("=: \t\f", rune(line[end])) {
+		if line[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	key, err := unescapeProperty(line[:end])
+	if err != nil {
+		return "", "", err
+	}
+	rest := strings.TrimLeft(line[end:], " \t\f")
+	if strings.HasPrefix(rest, "=") || strings.HasPrefix(rest, ":") {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	value, err := unescapeProperty(rest)
+	return key, value, err
+}
+
+func unescapeProperty(s string) (string, error) {
+	var units []uint16
+	for i := 0; i < len(s); {
+		if s[i] != '\\' {
+			r := []rune(s[i:])[0]
+			units = append(units, utf16.Encode([]rune{r})...)
+			i += len(string(r))
+			continue
+		}
+		n, escaped, err := propertyEscape(s[i:])
+		if err != nil {
+			return "", err
+		}
+		units = append(units, escaped...)
+		i += n
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// propertyEscape reads the escape s starts with and returns its length and
+// the UTF-16 code units it stands for.
+func propertyEscape(s string) (int, []uint16, error) {
+	if len(s) < 2 {
+		return 0, nil, fmt.Errorf("line continues after %q", s)
+	}
+	switch s[1] {
+	case 't':
+		return 2, []uint16{'\t'}, nil
+	case 'n':
+		return 2, []uint16{'\n'}, nil
+	case 'r':
+		return 2, []uint16{'\r'}, nil
+	case 'f':
+		return 2, []uint16{'\f'}, nil
+	case 'u':
+		if len(s) < 6 {
+			return 0, nil, fmt.Errorf("malformed \\u escape %q", s)
+		}
+		unit, err := strconv.ParseUint(s[2:6], 16, 16)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 6, []uint16{uint16(unit)}, nil
+	default:
+		return 2, []uint16{uint16(s[1])}, nil
+	}
+}
+
+// TestProperties parses the properties output back with a properties
+// reader.
+func TestProperties(t *testing.T) {
+	if err := parseOptions("format=properties"); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(strings.Builder)
+	writeProperties(&lineWriter{w: buf}, escapeEntries())
+	got := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			t.Fatalf("properties line %q reads as a comment", line)
+		}
+		key, value, err := parseProperty(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[key] = value
+	}
+	want := make(map[string]string)
+	for _, e := range escapeEntries() {
+		want[e.protoName] = e.swiftName
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("properties output parses to %q, want %q", got, want)
+	}
+}
+
+// TestMarkdown checks that every row of the Markdown table has the three
+// columns of its header, pipes in names included.
+func TestMarkdown(t *testing.T) {
+	if err := parseOptions("format=markdown"); err != nil {
+		t.Fatal(err)
+	}
+	entries := []entry{
+		{kind: messageKind, protoName: "b.Pipe|Name", swiftName: "B_Pipe|Name"},
+		{kind: enumKind, protoName: "a.Kind", swiftName: "A_Kind"},
+	}
+	buf := new(strings.Builder)
+	writeMarkdown(&lineWriter{w: buf}, entries)
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	want := [][]string{
+		{"Proto Name", "Swift Name", "Kind"},
+		{"---", "---", "---"},
+		{"a.Kind", "A_Kind", "enum"},
+		{"b.Pipe|Name", "B_Pipe|Name", "message"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("markdown table has %d lines, want %d:\n%s", len(lines), len(want), buf.String())
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "| ") || !strings.HasSuffix(line, " |") {
+			t.Errorf("markdown row %q is not enclosed in pipes", line)
+			continue
+		}
+		// Split on the pipes that aren't escaped.
+		var cells []string
+		for _, cell := range strings.Split(strings.Replace(line[2:len(line)-2], `\|`, "\x00", -1), " | ") {
+			cells = append(cells, strings.Replace(cell, "\x00", "|", -1))
+		}
+		if !reflect.DeepEqual(cells, want[i]) {
+			t.Errorf("markdown row %q has the cells %q, want %q", line, cells, want[i])
+		}
+	}
+}
+
+// TestStampDeterminism generates each format twice, checking that the runs
+// agree and that only a stamped output names the plugin version.
+func TestStampDeterminism(t *testing.T) {
+	for _, format := range []string{"text", "json", "csv", "swiftdict", "markdown", "properties"} {
+		parameter := "single_file,format=" + format
+		run := func(parameter string) string {
+			files := generateFiles(t, newRequest(t, parameter, chunkFiles))
+			if len(files) != 1 {
+				t.Fatalf("%s generated %d files, want 1", parameter, len(files))
+			}
+			for _, content := range files {
+				return content
+			}
+			return ""
+		}
+		plain := run(parameter)
+		if again := run(parameter); again != plain {
+			t.Errorf("%s differs between runs:\n%s\n%s", parameter, plain, again)
+		}
+		if strings.Contains(plain, pluginVersion) {
+			t.Errorf("%s names the plugin version without stamp:\n%s", parameter, plain)
+		}
+		if format == "json" || format == "csv" {
+			continue
+		}
+		stamped := run(parameter + ",stamp")
+		if again := run(parameter + ",stamp"); again != stamped {
+			t.Errorf("%s,stamp differs between runs:\n%s\n%s", parameter, stamped, again)
+		}
+		if format == "text" {
+			// The text header names the version too under stamp.
+			plain = strings.Replace(plain, "# "+pluginName+"\n", "# "+pluginName+" "+pluginVersion+"\n", 1)
+		}
+		stamp := strings.SplitN(stamped, "\n", 2)
+		if !strings.Contains(stamp[0], pluginName+" "+pluginVersion+" sha256:") || stamp[1] != plain {
+			t.Errorf("%s,stamp is not the stamp line followed by the unstamped output:\n%s", parameter, stamped)
+		}
+	}
+}
+
+func TestKindPrefix(t *testing.T) {
+	const files = `
+		file {
+			name: "zoo.proto"
+			package: "zoo"
+			message_type {
+				name: "Animal"
+				nested_type { name: "Inner" }
+				enum_type { name: "Sex" value { name: "SEX_UNKNOWN" number: 0 } }
+			}
+			enum_type { name: "Diet" value { name: "DIET_UNKNOWN" number: 0 } }
+		}
+	`
+	tests := []struct {
+		parameter string
+		lines     []string
+	}{
+		{"kind_prefix_message=M_", []string{
+			"zoo.Animal M_Zoo_Animal",
+			"zoo.Animal.Inner M_Zoo_Animal.Inner",
+			"zoo.Diet Zoo_Diet",
+		}},
+		// Nested enums only follow the prefix of their message.
+		{"kind_prefix_enum=E_", []string{
+			"zoo.Animal Zoo_Animal",
+			"zoo.Animal.Sex Zoo_Animal.Sex",
+			"zoo.Diet E_Zoo_Diet",
+			"zoo.Diet.DIET_UNKNOWN E_Zoo_Diet.unknown",
+		}},
+		{"kind_prefix_message=M_,kind_prefix_enum=E_,kind_prefix_order=package_first", []string{
+			"zoo.Animal Zoo_M_Animal",
+			"zoo.Animal.Sex Zoo_M_Animal.Sex",
+			"zoo.Diet Zoo_E_Diet",
+		}},
+	}
+	for _, test := range tests {
+		content := generateFiles(t, newRequest(t, "single_file,"+test.parameter, files))["mapper.txt"]
+		hasLines(t, content, test.lines...)
+	}
+	for _, parameter := range []string{"kind_prefix_message=1x", "kind_prefix_enum=a-b", "kind_prefix_order=x"} {
+		if err := parseOptions(parameter); err == nil {
+			t.Errorf("parseOptions(%q) succeeded, want an error", parameter)
+		}
+	}
+}
+
+// TestInitialization flags the proto2 messages with required fields of their
+// own or reached through message fields, cycles included.
+func TestInitialization(t *testing.T) {
+	req := newRequest(t, "single_file,initialization", `
+		file {
+			name: "req.proto"
+			package: "req"
+			message_type {
+				name: "Direct"
+				field { name: "id" number: 1 label: LABEL_REQUIRED type: TYPE_INT32 }
+			}
+			message_type {
+				name: "Transitive"
+				field { name: "direct" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".req.Direct" }
+			}
+			message_type {
+				name: "Repeated"
+				field { name: "items" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".req.Transitive" }
+			}
+			message_type {
+				name: "CycleA"
+				field { name: "b" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".req.CycleB" }
+			}
+			message_type {
+				name: "CycleB"
+				field { name: "a" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".req.CycleA" }
+			}
+			message_type {
+				name: "RequiredCycle"
+				field { name: "self" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".req.RequiredCycle" }
+				field { name: "c" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".req.CycleC" }
+			}
+			message_type {
+				name: "CycleC"
+				field { name: "back" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".req.RequiredCycle" }
+				field { name: "id" number: 2 label: LABEL_REQUIRED type: TYPE_INT32 }
+			}
+			message_type { name: "Plain" field { name: "id" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 } }
+		}
+	`)
+	content := generateFiles(t, req)["mapper.txt"]
+	hasLines(t, content,
+		"req.Direct Req_Direct true",
+		"req.Transitive Req_Transitive true",
+		"req.Repeated Req_Repeated true",
+		"req.CycleA Req_CycleA false",
+		"req.CycleB Req_CycleB false",
+		"req.RequiredCycle Req_RequiredCycle true",
+		"req.CycleC Req_CycleC true",
+		"req.Plain Req_Plain false",
+	)
+}
+
+func TestPackageIndex(t *testing.T) {
+	req := newRequest(t, "single_file,package_index", `
+		file { name: "zoo/b.proto" package: "zoo" message_type { name: "B" } }
+		file { name: "zoo/a.proto" package: "zoo" message_type { name: "A" } }
+		file { name: "farm/cow.proto" package: "farm" message_type { name: "Cow" } }
+		file { name: "loose.proto" message_type { name: "Loose" } }
+	`)
+	index, ok := generateFiles(t, req)["package_index.txt"]
+	if !ok {
+		t.Fatal("package_index generated no package_index.txt")
+	}
+	want := "<none> loose.proto\nfarm farm/cow.proto\nzoo zoo/a.proto zoo/b.proto\n"
+	if index != want {
+		t.Errorf("package index is\n%s\nwant\n%s", index, want)
+	}
+}
+
+// TestFileAndNameKey names foo.Bar from two descriptor sets declaring it in
+// different files, which a single request can't, as protodesc rejects the
+// conflict. The plain keys are identical; key=file_and_name tells them apart.
+func TestFileAndNameKey(t *testing.T) {
+	keys := make(map[string]bool)
+	for _, path := range []string{"v1/foo.proto", "v2/foo.proto"} {
+		files := `file { name: "` + path + `" package: "foo" message_type { name: "Bar" field { name: "x" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 } } }`
+		hasLines(t, generateFiles(t, newRequest(t, "single_file", files))["mapper.txt"], "foo.Bar Foo_Bar")
+		content := generateFiles(t, newRequest(t, "single_file,key=file_and_name", files))["mapper.txt"]
+		hasLines(t, content, path+"::foo.Bar Foo_Bar", path+"::foo.Bar.x Foo_Bar.x")
+		for _, line := range strings.Split(content, "\n") {
+			if len(line) > 0 && !strings.HasPrefix(line, "#") {
+				key := strings.Fields(line)[0]
+				if keys[key] {
+					t.Errorf("key %q appears in both descriptor sets", key)
+				}
+				keys[key] = true
+			}
+		}
+	}
+}
+
+const serviceFiles = `
+	file {
+		name: "chat.proto"
+		package: "chat"
+		message_type { name: "Msg" }
+		service {
+			name: "Chat"
+			method { name: "Send" input_type: ".chat.Msg" output_type: ".chat.Msg" }
+			method { name: "Upload" input_type: ".chat.Msg" output_type: ".chat.Msg" client_streaming: true }
+			method { name: "Watch" input_type: ".chat.Msg" output_type: ".chat.Msg" server_streaming: true }
+			method { name: "Talk" input_type: ".chat.Msg" output_type: ".chat.Msg" client_streaming: true server_streaming: true }
+		}
+	}
+`
+
+// TestMethodStreaming checks the streaming kind of each method, which leaves
+// its name alone.
+func TestMethodStreaming(t *testing.T) {
+	content := generateFiles(t, newRequest(t, "method_types,single_file", serviceFiles))["mapper.txt"]
+	hasLines(t, content,
+		"chat.Chat.Send Chat_Chat.send unary Chat_Msg Chat_Msg",
+		"chat.Chat.Upload Chat_Chat.upload client-stream Chat_Msg Chat_Msg",
+		"chat.Chat.Watch Chat_Chat.watch server-stream Chat_Msg Chat_Msg",
+		"chat.Chat.Talk Chat_Chat.talk bidi Chat_Msg Chat_Msg",
+	)
+}
+
+// TestConnect checks that format=connect keys only the methods, by procedure
+// path.
+func TestConnect(t *testing.T) {
+	content := generateFiles(t, newRequest(t, "format=connect,single_file", serviceFiles))["mapper.txt"]
+	want := "chat.Chat/Send Chat_Chat.send\n" +
+		"chat.Chat/Talk Chat_Chat.talk\n" +
+		"chat.Chat/Upload Chat_Chat.upload\n" +
+		"chat.Chat/Watch Chat_Chat.watch\n"
+	if content != want {
+		t.Errorf("format=connect mapping is\n%s\nwant\n%s", content, want)
+	}
+}
+
+const paymentFiles = `
+	file {
+		name: "pay.proto"
+		package: "pay"
+		syntax: "proto3"
+		message_type {
+			name: "Payment"
+			field { name: "card" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+			field { name: "bank_account" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+			field { name: "default" number: 3 label: LABEL_OPTIONAL type: TYPE_BOOL oneof_index: 0 }
+			field { name: "a" number: 4 label: LABEL_OPTIONAL type: TYPE_INT32 oneof_index: 1 proto3_optional: true }
+			field { name: "b" number: 5 label: LABEL_OPTIONAL type: TYPE_INT32 oneof_index: 2 proto3_optional: true }
+			field { name: "self" number: 6 label: LABEL_OPTIONAL type: TYPE_INT32 oneof_index: 3 proto3_optional: true }
+			oneof_decl { name: "method" }
+			oneof_decl { name: "_a" }
+			oneof_decl { name: "_b" }
+			oneof_decl { name: "_self" }
+			nested_type { name: "Inner" nested_type { name: "Deep" } }
+		}
+	}
+`
+
+// TestOneofCases checks the case of each member of a oneof, reserved names
+// included.
+func TestOneofCases(t *testing.T) {
+	content := generateFiles(t, newRequest(t, "single_file", paymentFiles))["mapper.txt"]
+	hasLines(t, content,
+		"pay.Payment.method Pay_Payment.OneOf_Method",
+		"pay.Payment.method.card Pay_Payment.OneOf_Method.card",
+		"pay.Payment.method.bank_account Pay_Payment.OneOf_Method.bankAccount",
+		"pay.Payment.method.default Pay_Payment.OneOf_Method.defaultField",
+	)
+}
+
+// TestProto3Optional checks that the synthetic oneofs of proto3 optional
+// fields get no entries, while the fields do.
+func TestProto3Optional(t *testing.T) {
+	content := generateFiles(t, newRequest(t, "single_file", paymentFiles))["mapper.txt"]
+	hasLines(t, content,
+		"pay.Payment.a Pay_Payment.a",
+		"pay.Payment.b Pay_Payment.b",
+		"pay.Payment.self Pay_Payment.selfField",
+	)
+	for _, line := range strings.Split(content, "\n") {
+		if strings.Contains(line, "OneOf_") && !strings.Contains(line, "OneOf_Method") {
+			t.Errorf("mapping has an entry for a synthetic oneof: %q", line)
+		}
+	}
+	for _, oneof := range []string{"_a", "_b", "_self"} {
+		if strings.Contains(content, "pay.Payment."+oneof+" ") {
+			t.Errorf("mapping has an entry for the synthetic oneof %s:\n%s", oneof, content)
+		}
+	}
+}
+
+func TestSlug(t *testing.T) {
+	req := newRequest(t, "single_file,slug", `
+		file { name: "o.proto" package: "acme.shop_v1" message_type { name: "Order" nested_type { name: "LineItem" } } }
+	`)
+	hasLines(t, generateFiles(t, req)["mapper.txt"],
+		"acme.shop_v1.Order Acme_ShopV1_Order acme-shop-v1-order",
+		"acme.shop_v1.Order.LineItem Acme_ShopV1_Order.LineItem acme-shop-v1-order-line-item",
+	)
+}
+
+// TestProtoMessageName checks that the protoMessageName column is the proto
+// full name, nested messages included.
+func TestProtoMessageName(t *testing.T) {
+	content := generateFiles(t, newRequest(t, "single_file,proto_message_name", paymentFiles))["mapper.txt"]
+	hasLines(t, content,
+		"pay.Payment Pay_Payment pay.Payment",
+		"pay.Payment.Inner Pay_Payment.Inner pay.Payment.Inner",
+		"pay.Payment.Inner.Deep Pay_Payment.Inner.Deep pay.Payment.Inner.Deep",
+	)
+}
+
+// TestSkipDeprecated checks that skip_deprecated leaves out everything
+// nested in a deprecated message, even what isn't deprecated itself.
+func TestSkipDeprecated(t *testing.T) {
+	req := newRequest(t, "single_file,skip_deprecated", `
+		file {
+			name: "old.proto"
+			package: "old"
+			message_type {
+				name: "Legacy"
+				options { deprecated: true }
+				field { name: "id" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 }
+				nested_type { name: "Part" field { name: "x" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 } }
+				enum_type { name: "Kind" value { name: "KIND_UNKNOWN" number: 0 } }
+			}
+			message_type { name: "Current" }
+			enum_type { name: "Gone" options { deprecated: true } value { name: "GONE_UNKNOWN" number: 0 } }
+		}
+	`)
+	content := generateFiles(t, req)["mapper.txt"]
+	hasLines(t, content, "old.Current Old_Current")
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, "old.Legacy") || strings.HasPrefix(line, "old.Gone") {
+			t.Errorf("skip_deprecated kept %q", line)
+		}
+	}
+}
+
+func TestStatsSteps(t *testing.T) {
+	req := newRequest(t, "stats,case=lower,single_file", `
+		file {
+			name: "x.proto"
+			package: "x"
+			message_type { name: "Outer" nested_type { name: "Inner" } }
+		}
+	`)
+	content := generateFiles(t, req)["mapper.txt"]
+	if want := "# camel-cased: 2\n# prefixed: 0\n# disambiguated: 0\n"; !strings.Contains(content, want) {
+		t.Errorf("case=lower mapping lacks stats\n%s\n%s", want, content)
+	}
+
+	req = newRequest(t, "stats,name_option=50000,single_file", `
+		file {
+			name: "type.proto"
+			message_type { name: "Type" options {} }
+		}
+	`)
+	options := req.ProtoFile[0].MessageType[0].Options
+	options.ProtoReflect().SetUnknown(protowire.AppendString(protowire.AppendTag(nil, 50000, protowire.BytesType), "Kind"))
+	content = generateFiles(t, req)["mapper.txt"]
+	hasLines(t, content, "Type Kind")
+	if want := "# camel-cased: 0\n# prefixed: 0\n# disambiguated: 0\n"; !strings.Contains(content, want) {
+		t.Errorf("name_option mapping lacks stats\n%s\n%s", want, content)
+	}
+}
+
+// TestTextOnlyOptions checks that the options adding columns are refused by
+// the formats that would drop the columns.
+func TestTextOnlyOptions(t *testing.T) {
+	for _, option := range []string{"accessor_names", "first_enum_value", "method_types", "proto_field_types", "proto_message_name", "slug", "with_source"} {
+		for _, format := range []string{"json", "csv", "markdown", "properties"} {
+			if err := parseOptions(option + ",format=" + format); err == nil {
+				t.Errorf("%s was accepted with format=%s", option, format)
+			}
+		}
+		if err := parseOptions(option); err != nil {
+			t.Errorf("%s was refused with the text format: %v", option, err)
+		}
+	}
+}
+
+func TestModuleQualifiesColumns(t *testing.T) {
+	req := newRequest(t, "module=App,method_types,single_file", `
+		file { name: "types.proto" package: "types" message_type { name: "Request" } }
+		file {
+			name: "api.proto"
+			package: "api"
+			dependency: "types.proto"
+			message_type { name: "Response" }
+			service {
+				name: "Greeter"
+				method { name: "Greet" input_type: ".types.Request" output_type: ".api.Response" }
+			}
+		}
+	`)
+	req.FileToGenerate = []string{"api.proto"}
+	content := generateFiles(t, req)["mapper.txt"]
+	hasLines(t, content,
+		"api.Greeter App.Api_Greeter App.Api_GreeterClient App.Api_GreeterProvider",
+		"api.Greeter.Greet App.Api_Greeter.greet unary App.Types_Request App.Api_Response",
+	)
+}
+
+func TestMaxCollisions(t *testing.T) {
+	req := newRequest(t, "strict,max_collisions=2", `
+		file { name: "a.proto" package: "a" options { swift_prefix: "P" } message_type { name: "A" } message_type { name: "B" } message_type { name: "C" } }
+		file { name: "b.proto" package: "b" options { swift_prefix: "P" } message_type { name: "A" } message_type { name: "B" } message_type { name: "C" } }
+	`)
+	_, err := generate(req)
+	if err == nil {
+		t.Fatal("strict passed with collisions")
+	}
+	want := "Swift name collisions:\nPA a.A b.A\nPB a.B b.B\n... and 1 more"
+	if err.Error() != want {
+		t.Errorf("strict failed with\n%s\nwant\n%s", err, want)
+	}
+}
+
+func TestSyntaxHeader(t *testing.T) {
+	req := newRequest(t, "", `
+		file { name: "two.proto" package: "two" message_type { name: "Two" } }
+		file { name: "explicit_two.proto" package: "two" syntax: "proto2" message_type { name: "ExplicitTwo" } }
+		file { name: "three.proto" package: "three" syntax: "proto3" message_type { name: "Three" } }
+	`)
+	files := generateFiles(t, req)
+	tests := []struct {
+		file   string
+		syntax string
+	}{
+		{"two.namer.txt", "proto2"},
+		{"explicit_two.namer.txt", "proto2"},
+		{"three.namer.txt", "proto3"},
+	}
+	for _, test := range tests {
+		if !strings.Contains(files[test.file], "\n# syntax: "+test.syntax+"\n") {
+			t.Errorf("%s lacks the %s syntax header:\n%s", test.file, test.syntax, files[test.file])
+		}
+	}
+	req.Parameter = proto.String("single_file")
+	if content := generateFiles(t, req)["mapper.txt"]; strings.Contains(content, "# syntax:") {
+		t.Errorf("single_file mapping has a syntax header:\n%s", content)
+	}
+}
+
+// referencedFiles declares types in other.proto that the fields of a.proto
+// and b.proto use, directly, nested and as a map value.
+const referencedFiles = `
+	file {
+		name: "other.proto"
+		package: "other"
+		message_type { name: "Value" }
+		message_type { name: "Outer" nested_type { name: "Inner" } }
+		message_type { name: "Unused" }
+		enum_type { name: "Kind" value { name: "KIND_UNKNOWN" number: 0 } }
+	}
+	file {
+		name: "a.proto"
+		package: "a"
+		dependency: "other.proto"
+		message_type {
+			name: "A"
+			field { name: "value" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".other.Value" }
+			field { name: "kind" number: 2 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".other.Kind" }
+			field { name: "again" number: 3 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".other.Value" }
+			field { name: "self" number: 4 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".a.A" }
+			nested_type {
+				name: "Nested"
+				field { name: "inner" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".other.Outer.Inner" }
+			}
+		}
+	}
+	file {
+		name: "b.proto"
+		package: "b"
+		dependency: "other.proto"
+		message_type {
+			name: "B"
+			field { name: "values" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".b.B.ValuesEntry" }
+			nested_type {
+				name: "ValuesEntry"
+				options { map_entry: true }
+				field { name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+				field { name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".other.Value" }
+			}
+		}
+	}
+`
+
+func TestReferenced(t *testing.T) {
+	req := newRequest(t, "referenced", referencedFiles)
+	req.FileToGenerate = []string{"a.proto", "b.proto"}
+	files := generateFiles(t, req)
+	tests := []struct {
+		file       string
+		referenced []string
+	}{
+		{"a.namer.txt", []string{"other.Kind Other_Kind", "other.Outer.Inner Other_Outer.Inner", "other.Value Other_Value"}},
+		{"b.namer.txt", []string{"other.Value Other_Value"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, line := range strings.Split(files[test.file], "\n") {
+			if strings.HasPrefix(line, "other.") {
+				got = append(got, line)
+			}
+		}
+		if !reflect.DeepEqual(got, test.referenced) {
+			t.Errorf("%s lists referenced types %q, want %q", test.file, got, test.referenced)
+		}
+	}
+
+	req.Parameter = proto.String("referenced,single_file")
+	content := generateFiles(t, req)["mapper.txt"]
+	if n := strings.Count(content, "\nother.Value "); n != 1 {
+		t.Errorf("single_file mapping lists other.Value %d times, want once:\n%s", n, content)
+	}
+	if strings.Contains(content, "Collision") || strings.Contains(content, "collision") {
+		t.Errorf("single_file mapping reports collisions:\n%s", content)
+	}
+}
+
+// TestReferencedMapValue checks that a map field refers to its value type,
+// a real message of another file, and not to its entry message, with and
+// without include_map_entries.
+func TestReferencedMapValue(t *testing.T) {
+	for _, parameter := range []string{"referenced", "referenced,include_map_entries"} {
+		req := newRequest(t, parameter, referencedFiles)
+		req.FileToGenerate = []string{"b.proto"}
+		content := generateFiles(t, req)["b.namer.txt"]
+		if !strings.Contains(content, "\nother.Value Other_Value\n") {
+			t.Errorf("%s: mapping lacks the map value type other.Value:\n%s", parameter, content)
+		}
+		listed, want := strings.Contains(content, "ValuesEntry"), parameter != "referenced"
+		if listed != want {
+			t.Errorf("%s: mapping lists the entry message: %v, want %v:\n%s", parameter, listed, want, content)
+		}
+	}
+}
+
+// csvRecords returns the records of kind in a format=csv mapping.
+func csvRecords(content, kind string) []string {
+	var records []string
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, kind+",") {
+			records = append(records, strings.TrimPrefix(line, kind+","))
+		}
+	}
+	return records
+}
+
+func TestFieldMaskPaths(t *testing.T) {
+	req := newRequest(t, "fieldmask_paths,format=csv,single_file", `
+		file {
+			name: "mask.proto"
+			package: "mask"
+			message_type {
+				name: "Outer"
+				field { name: "inner" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".mask.Inner" }
+				field { name: "list" number: 2 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".mask.Inner" }
+				field { name: "parent" number: 3 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".mask.Outer" }
+				field { name: "name" number: 4 label: LABEL_OPTIONAL type: TYPE_STRING }
+			}
+			message_type {
+				name: "Inner"
+				field { name: "first_name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+				field { name: "leaf" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".mask.Leaf" }
+			}
+			message_type {
+				name: "Leaf"
+				field { name: "leaf_id" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 }
+			}
+		}
+	`)
+	got := csvRecords(generateFiles(t, req)["mapper.csv"], "field_path")
+	want := []string{
+		"mask.Inner.leaf.leaf_id,Mask_Inner.leaf.leafID",
+		"mask.Outer.inner.first_name,Mask_Outer.inner.firstName",
+		"mask.Outer.inner.leaf,Mask_Outer.inner.leaf",
+		"mask.Outer.inner.leaf.leaf_id,Mask_Outer.inner.leaf.leafID",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("field paths are\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestFieldOrder(t *testing.T) {
+	req := newRequest(t, "field_order,single_file", `
+		file {
+			name: "order.proto"
+			package: "order"
+			message_type {
+				name: "Order"
+				field { name: "total" number: 3 label: LABEL_OPTIONAL type: TYPE_INT64 }
+				field { name: "order_id" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+				field { name: "items" number: 10 label: LABEL_REPEATED type: TYPE_STRING }
+				field { name: "note" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+			}
+			message_type { name: "Empty" }
+		}
+	`)
+	content := generateFiles(t, req)["mapper.txt"]
+	hasLines(t, content,
+		"order.Order Order_Order 3:total,1:orderID,10:items,2:note",
+		"order.Empty Order_Empty -",
+	)
+}
+
+func TestAncestryFormats(t *testing.T) {
+	files := `
+		file {
+			name: "tree.proto"
+			package: "tree"
+			message_type {
+				name: "Outer"
+				nested_type {
+					name: "Inner"
+					field { name: "leaf_id" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+				}
+			}
+		}
+	`
+	content := generateFiles(t, newRequest(t, "ancestry,format=json,single_file", files))["mapper.json"]
+	var groups map[string]map[string]jsonEntry
+	if err := json.Unmarshal([]byte(content), &groups); err != nil {
+		t.Fatal(err)
+	}
+	want := jsonEntry{SwiftName: "Tree_Outer.Inner.leafID", Ancestry: []string{"Tree_Outer", "Inner", "leafID"}}
+	if got := groups["fields"]["tree.Outer.Inner.leaf_id"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON field entry = %+v, want %+v", got, want)
+	}
+
+	content = generateFiles(t, newRequest(t, "ancestry,format=csv,single_file", files))["mapper.csv"]
+	if !strings.HasPrefix(content, "kind,proto_full_name,swift_name,ancestry\n") {
+		t.Errorf("CSV header lacks the ancestry column:\n%s", content)
+	}
+	if got, want := csvRecords(content, "field"), []string{"tree.Outer.Inner.leaf_id,Tree_Outer.Inner.leafID,Tree_Outer/Inner/leafID"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CSV field records = %q, want %q", got, want)
+	}
+
+	for _, format := range []string{"markdown", "properties"} {
+		if err := parseOptions("ancestry,format=" + format); err == nil {
+			t.Errorf("ancestry was accepted with format=%s", format)
+		}
+	}
+}
+
+// enumFiles declares an open proto3 enum and a closed proto2 enum.
+const enumFiles = `
+	file {
+		name: "open.proto"
+		package: "open"
+		syntax: "proto3"
+		enum_type {
+			name: "Color"
+			value { name: "COLOR_UNSPECIFIED" number: 0 }
+			value { name: "COLOR_RED" number: 1 }
+		}
+	}
+	file {
+		name: "closed.proto"
+		package: "closed"
+		enum_type {
+			name: "Shape"
+			value { name: "SHAPE_CIRCLE" number: 1 }
+		}
+	}
+`
+
+func TestUnrecognized(t *testing.T) {
+	content := generateFiles(t, newRequest(t, "unrecognized,ancestry,slug,single_file", enumFiles))["mapper.txt"]
+	hasLines(t, content,
+		"open.Color.COLOR_RED Open_Color.red Open_Color/red open-color-red",
+		"open.Color.UNRECOGNIZED Open_Color.UNRECOGNIZED Open_Color/UNRECOGNIZED open-color-unrecognized",
+	)
+	if strings.Contains(content, "closed.Shape.UNRECOGNIZED") {
+		t.Errorf("closed enum has an UNRECOGNIZED case:\n%s", content)
+	}
+}
+
+func TestCountSynthetic(t *testing.T) {
+	tests := []struct {
+		parameter string
+		want      string
+	}{
+		{"unrecognized,stats,single_file", "# enum values: 3\n"},
+		{"unrecognized,stats,count_synthetic,single_file", "# enum values: 4\n"},
+	}
+	for _, test := range tests {
+		content := generateFiles(t, newRequest(t, test.parameter, enumFiles))["mapper.txt"]
+		if !strings.HasSuffix(content, test.want) {
+			t.Errorf("%s: mapping does not end with %q:\n%s", test.parameter, test.want, content)
+		}
+	}
+}
+
+func TestAccessorNames(t *testing.T) {
+	req := newRequest(t, "accessor_names,single_file", `
+		file {
+			name: "tree.proto"
+			package: "tree"
+			syntax: "proto3"
+			message_type {
+				name: "Node"
+				field { name: "parent" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".tree.Node" }
+				field { name: "label" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+				field { name: "weight" number: 3 label: LABEL_OPTIONAL type: TYPE_INT32 oneof_index: 0 proto3_optional: true }
+				oneof_decl { name: "_weight" }
+			}
+		}
+	`)
+	content := generateFiles(t, req)["mapper.txt"]
+	hasLines(t, content,
+		"tree.Node.parent Tree_Node.parent hasParent clearParent",
+		"tree.Node.label Tree_Node.label - -",
+		"tree.Node.weight Tree_Node.weight hasWeight clearWeight",
+	)
+}
+
+// TestProtoFieldTypes checks that the proto_field_types column joins against
+// the keys of the mapping.
+func TestProtoFieldTypes(t *testing.T) {
+	req := newRequest(t, "proto_field_types,single_file", `
+		file {
+			name: "shop.proto"
+			package: "shop"
+			message_type {
+				name: "Order"
+				field { name: "id" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+				field { name: "item" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".shop.Item" }
+				field { name: "status" number: 3 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".shop.Status" }
+				field { name: "items" number: 4 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".shop.Order.ItemsEntry" }
+				field { name: "counts" number: 5 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".shop.Order.CountsEntry" }
+				nested_type {
+					name: "ItemsEntry"
+					field { name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+					field { name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".shop.Item" }
+					options { map_entry: true }
+				}
+				nested_type {
+					name: "CountsEntry"
+					field { name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_INT64 }
+					field { name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 }
+					options { map_entry: true }
+				}
+			}
+			message_type { name: "Item" }
+			enum_type { name: "Status" value { name: "STATUS_UNKNOWN" number: 0 } }
+		}
+	`)
+	content := generateFiles(t, req)["mapper.txt"]
+	hasLines(t, content,
+		"shop.Order.id Shop_Order.id -",
+		"shop.Order.item Shop_Order.item shop.Item",
+		"shop.Order.status Shop_Order.status shop.Status",
+		"shop.Order.items Shop_Order.items map<string,shop.Item>",
+		"shop.Order.counts Shop_Order.counts map<int64,int32>",
+	)
+	for _, key := range []string{"\nshop.Item ", "\nshop.Status "} {
+		if !strings.Contains(content, key) {
+			t.Errorf("mapping lacks the type %q the column refers to:\n%s", key, content)
+		}
+	}
+}
+
+// TestProtoFieldTypesOneof checks that an enum-typed oneof member keeps both
+// its oneof case and its type column.
+func TestProtoFieldTypesOneof(t *testing.T) {
+	req := newRequest(t, "proto_field_types,single_file", `
+		file {
+			name: "shop.proto"
+			package: "shop"
+			syntax: "proto3"
+			message_type {
+				name: "Order"
+				field { name: "status" number: 1 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".shop.Status" oneof_index: 0 }
+				field { name: "note" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+				oneof_decl { name: "detail" }
+			}
+			enum_type { name: "Status" value { name: "STATUS_UNKNOWN" number: 0 } }
+		}
+	`)
+	content := generateFiles(t, req)["mapper.txt"]
+	hasLines(t, content,
+		"shop.Order.detail Shop_Order.OneOf_Detail",
+		"shop.Order.detail.status Shop_Order.OneOf_Detail.status",
+		"shop.Order.status Shop_Order.status shop.Status",
+		"shop.Status Shop_Status",
+	)
+}
+
+// TestEmitSchema validates sample JSON mappings against the emitted schema.
+func TestEmitSchema(t *testing.T) {
+	for _, parameter := range []string{"emit_schema,format=json,single_file", "emit_schema,format=json,ancestry,single_file"} {
+		files := generateFiles(t, newRequest(t, parameter, referencedFiles))
+		var schema, mapping interface{}
+		if err := json.Unmarshal([]byte(files["mapper.schema.json"]), &schema); err != nil {
+			t.Fatalf("%s: %v", parameter, err)
+		}
+		if err := json.Unmarshal([]byte(files["mapper.json"]), &mapping); err != nil {
+			t.Fatalf("%s: %v", parameter, err)
+		}
+		if err := validate(schema.(map[string]interface{}), mapping, "mapping"); err != nil {
+			t.Errorf("%s: %v", parameter, err)
+		}
+	}
+	if err := parseOptions("emit_schema"); err == nil {
+		t.Error("emit_schema was accepted with the text format")
+	}
+}
+
+// validate checks value against the subset of JSON Schema writeSchema uses:
+// type, properties, required, additionalProperties and items.
+func validate(schema map[string]interface{}, value interface{}, path string) error {
+	switch schema["type"] {
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: %v is not a string", path, value)
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: %v is not an array", path, value)
+		}
+		for i, item := range array {
+			if err := validate(schema["items"].(map[string]interface{}), item, path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: %v is not an object", path, value)
+		}
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := object[name.(string)]; !ok {
+					return fmt.Errorf("%s lacks %s", path, name)
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, member := range object {
+			memberSchema, ok := properties[name].(map[string]interface{})
+			if !ok {
+				if memberSchema, ok = schema["additionalProperties"].(map[string]interface{}); !ok {
+					return fmt.Errorf("%s has unexpected member %s", path, name)
+				}
+			}
+			if err := validate(memberSchema, member, path+"."+name); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%s: unsupported schema type %v", path, schema["type"])
+	}
+	return nil
+}
+
+func TestFirstEnumValue(t *testing.T) {
+	req := newRequest(t, "first_enum_value,single_file", `
+		file {
+			name: "level.proto"
+			package: "level"
+			enum_type {
+				name: "Level"
+				value { name: "LEVEL_HIGH" number: 3 }
+				value { name: "LEVEL_LOW" number: 1 }
+				value { name: "LEVEL_NONE" number: 0 }
+			}
+		}
+	`)
+	content := generateFiles(t, req)["mapper.txt"]
+	hasLines(t, content, "level.Level Level_Level high")
+}
+
+// TestCollisionSuffix checks that collision_mode=suffix renames a colliding
+// enum together with its values, and assigns the same suffixes whatever the
+// order of the files.
+func TestCollisionSuffix(t *testing.T) {
+	files := []string{`
+		file {
+			name: "a.proto"
+			package: "a"
+			options { swift_prefix: "P" }
+			enum_type { name: "Color" value { name: "COLOR_UNSPECIFIED" number: 0 } }
+		}`, `
+		file {
+			name: "b.proto"
+			package: "b"
+			options { swift_prefix: "P" }
+			enum_type { name: "Color" value { name: "COLOR_UNSPECIFIED" number: 0 } }
+		}`,
+	}
+	var want string
+	for _, set := range []string{files[0] + files[1], files[1] + files[0], files[0] + files[1]} {
+		content := generateFiles(t, newRequest(t, "collision_mode=suffix,single_file", set))["mapper.txt"]
+		hasLines(t, content,
+			"a.Color PColor",
+			"a.Color.COLOR_UNSPECIFIED PColor.unspecified",
+			"b.Color PColor_2",
+			"b.Color.COLOR_UNSPECIFIED PColor_2.unspecified",
+			"# renamed b.Color PColor -> PColor_2",
+		)
+		if len(want) == 0 {
+			want = content
+		} else if content != want {
+			t.Errorf("mapping changed between runs:\n%s\nwant\n%s", content, want)
+		}
+	}
+}
+
+// chunkFiles declares enough entities to fill several chunks.
+const chunkFiles = `
+	file {
+		name: "zoo.proto"
+		package: "zoo"
+		message_type {
+			name: "Animal"
+			field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+			field { name: "legs" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 }
+		}
+		message_type { name: "Keeper" }
+		enum_type { name: "Diet" value { name: "DIET_PLANTS" number: 0 } }
+	}
+`
+
+// TestChunkHeaders checks that every chunk repeats the text header, which
+// names the plugin version only under stamp.
+func TestChunkHeaders(t *testing.T) {
+	header := "# protoc-gen-namer\n# protoc version unknown\n# source protos: 1\n"
+	files := generateFiles(t, newRequest(t, "chunk_lines=5,single_file", chunkFiles))
+	if len(files) < 2 {
+		t.Fatalf("got %d chunks, want several", len(files))
+	}
+	for name, content := range files {
+		if !strings.HasPrefix(content, header) {
+			t.Errorf("%s does not start with the header:\n%s", name, content)
+		}
+		if n := strings.Count(content, "\n"); n > 5 {
+			t.Errorf("%s has %d lines, want at most 5", name, n)
+		}
+	}
+
+	content := generateFiles(t, newRequest(t, "stamp,single_file", chunkFiles))["mapper.txt"]
+	if lines := strings.Split(content, "\n"); len(lines) < 2 || lines[1] != "# "+pluginName+" "+pluginVersion {
+		t.Errorf("stamped mapping does not name the plugin version:\n%s", content)
+	}
+}
+
+// TestChunkSections checks that chunk_lines=N with group_by keeps every
+// entry, in order, in chunks of entries under their section header.
+func TestChunkSections(t *testing.T) {
+	whole := generateFiles(t, newRequest(t, "group_by=kind,single_file", chunkFiles))["mapper.txt"]
+	chunks := generateFiles(t, newRequest(t, "group_by=kind,chunk_lines=6,single_file", chunkFiles))
+	var entries []string
+	for i := 0; i < len(chunks); i++ {
+		name := "mapper." + strconv.Itoa(i) + ".txt"
+		lines := strings.Split(strings.TrimSuffix(chunks[name], "\n"), "\n")
+		if len(lines) > 6 {
+			t.Errorf("%s has %d lines, want at most 6", name, len(lines))
+		}
+		if len(lines) < 5 || !isSectionHeader(lines[3]) || isSectionHeader(lines[len(lines)-1]) {
+			t.Errorf("%s is not a section header followed by entries:\n%s", name, chunks[name])
+			continue
+		}
+		for _, line := range lines[4:] {
+			if !isSectionHeader(line) {
+				entries = append(entries, line)
+			}
+		}
+	}
+	var want []string
+	for _, line := range strings.Split(strings.TrimSuffix(whole, "\n"), "\n")[3:] {
+		if !isSectionHeader(line) {
+			want = append(want, line)
+		}
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("chunks hold entries %q, want %q", entries, want)
+	}
+}
+
+func TestEnumOpenness(t *testing.T) {
+	content := generateFiles(t, newRequest(t, "enum_openness,single_file", enumFiles))["mapper.txt"]
+	hasLines(t, content,
+		"open.Color Open_Color open",
+		"closed.Shape Closed_Shape closed",
+	)
+}
+
+// TestEditions checks that editions files, whose enum openness comes from
+// features this plugin can't resolve, are refused with a clear error.
+func TestEditions(t *testing.T) {
+	req := newRequest(t, "enum_openness", `
+		file {
+			name: "edition.proto"
+			package: "edition"
+			syntax: "editions"
+			enum_type { name: "Closed" value { name: "CLOSED_UNKNOWN" number: 0 } }
+		}
+	`)
+	if got, want := respond(req).GetError(), "edition.proto: editions files are not supported"; got != want {
+		t.Errorf("respond returned error %q, want %q", got, want)
+	}
+}
+
+// TestFieldCollision checks that proto2 fields camel-casing to the same
+// property are reported, and fail under strict.
+func TestFieldCollision(t *testing.T) {
+	files := `
+		file {
+			name: "camel.proto"
+			package: "camel"
+			message_type {
+				name: "M"
+				field { name: "foo_bar" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+				field { name: "fooBar" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+			}
+		}
+	`
+	content := generateFiles(t, newRequest(t, "single_file", files))["mapper.txt"]
+	hasLines(t, content,
+		"# Swift name collisions:",
+		"# Camel_M.fooBar camel.M.fooBar camel.M.foo_bar",
+	)
+	if got := respond(newRequest(t, "strict", files)).GetError(); !strings.Contains(got, "Camel_M.fooBar camel.M.fooBar camel.M.foo_bar") {
+		t.Errorf("strict returned error %q, want the collision", got)
+	}
+}
+
+// TestNestedOneofNames checks that same-named oneofs at different nesting
+// levels are told apart by their full names.
+func TestNestedOneofNames(t *testing.T) {
+	req := newRequest(t, "strict,single_file", `
+		file {
+			name: "oneofs.proto"
+			package: "oneofs"
+			message_type {
+				name: "Outer"
+				field { name: "a" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+				oneof_decl { name: "choice" }
+				nested_type {
+					name: "Inner"
+					field { name: "b" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+					oneof_decl { name: "choice" }
+				}
+			}
+		}
+	`)
+	content := generateFiles(t, req)["mapper.txt"]
+	hasLines(t, content,
+		"oneofs.Outer.choice Oneofs_Outer.OneOf_Choice",
+		"oneofs.Outer.Inner.choice Oneofs_Outer.Inner.OneOf_Choice",
+	)
+	if strings.Contains(content, "collisions") {
+		t.Errorf("mapping reports collisions:\n%s", content)
+	}
+}
@@ -0,0 +1,802 @@
+// Package namer computes the Swift names SwiftProtobuf generates for protobuf
+// descriptors.
+package namer
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Options tunes the naming rules. The zero value of each field keeps
+// SwiftProtobuf's behavior, except PrefixSeparator, Separator and
+// KindPrefixFirst, which DefaultOptions sets.
+type Options struct {
+	// PrefixSeparator follows a type prefix derived from the package name.
+	PrefixSeparator string
+	// Separator joins the names of nested entities in full names.
+	Separator string
+	// KindPrefixMessage and KindPrefixEnum are added to the type prefix of
+	// top-level messages and enums, before it if KindPrefixFirst is set.
+	KindPrefixMessage string
+	KindPrefixEnum    string
+	KindPrefixFirst   bool
+	// NumberSeparator puts an underscore before each run of digits.
+	NumberSeparator bool
+	// StripLeadingUnderscore drops leading underscores from type names.
+	StripLeadingUnderscore bool
+	// CIReserved matches reserved names ignoring case.
+	CIReserved bool
+	// NameOption is the field number of a string message option whose
+	// value replaces the computed name of the message.
+	NameOption protowire.Number
+	// LowerCaseMessages renders message names lowerCamelCase, without a
+	// prefix, for use as documentation keys rather than Swift types.
+	LowerCaseMessages bool
+	// DefaultPrefix stands in for the package name of files declaring none.
+	DefaultPrefix string
+	// NoPrefix leaves the type prefix off top-level types, for Swift code
+	// split into one module per package.
+	NoPrefix bool
+	// ObjcPrefixFallback uses objc_class_prefix, which SwiftProtobuf
+	// ignores, as the type prefix of files setting it but not swift_prefix.
+	// The google.protobuf files are left out: they set GPB, but SwiftProtobuf
+	// ships the well-known types as Google_Protobuf_*.
+	ObjcPrefixFallback bool
+	// Reserved names are disambiguated on top of the Swift keywords and
+	// SwiftProtobuf names built in.
+	Reserved []string
+	// Abbreviations are uppercased as a whole when they appear as a segment
+	// of a camel-cased name, in addition to url, http, https and id unless
+	// ReplaceAbbreviations is set.
+	Abbreviations        []string
+	ReplaceAbbreviations bool
+}
+
+// DefaultOptions returns the options matching SwiftProtobuf.
+func DefaultOptions() Options {
+	return Options{PrefixSeparator: "_", Separator: ".", KindPrefixFirst: true}
+}
+
+// Namer computes Swift names under a fixed set of options. It is not changed
+// after New, so a Namer may be shared by concurrent callers.
+type Namer struct {
+	opts Options
+	// reserved holds the reserved names, lowercased under CIReserved.
+	reserved      map[string]bool
+	abbreviations map[string]bool
+	// file is the file set by ForFile, whose type prefix is filePrefix.
+	file       protoreflect.FileDescriptor
+	filePrefix string
+}
+
+// New returns a Namer applying opts. The names and words registered with
+// RegisterReserved and RegisterAbbreviations are copied, so registering more
+// later does not affect it.
+func New(opts Options) *Namer {
+	n := &Namer{
+		opts:          opts,
+		reserved:      make(map[string]bool, len(reservedNames)+len(opts.Reserved)),
+		abbreviations: make(map[string]bool, len(abbreviations)+len(opts.Abbreviations)),
+	}
+	for name := range reservedNames {
+		n.reserved[n.reservedKey(name)] = true
+	}
+	for _, name := range opts.Reserved {
+		n.reserved[n.reservedKey(name)] = true
+	}
+	if !opts.ReplaceAbbreviations {
+		for word := range abbreviations {
+			n.abbreviations[word] = true
+		}
+	}
+	for _, word := range opts.Abbreviations {
+		n.abbreviations[strings.ToLower(word)] = true
+	}
+	return n
+}
+
+// Options returns the options n applies.
+func (n *Namer) Options() Options {
+	return n.opts
+}
+
+// FullNameOfMessage returns the Swift name of message qualified by the names
+// of the messages it is nested in, e.g. Foo_Bar.Inner.
+func (n *Namer) FullNameOfMessage(message protoreflect.MessageDescriptor) string {
+	relativeName := n.RelativeNameOfMessage(message)
+	if container, ok := message.Parent().(protoreflect.MessageDescriptor); ok {
+		return n.FullNameOfMessage(container) + n.opts.Separator + relativeName
+	} else {
+		return relativeName
+	}
+}
+
+// RelativeNameOfMessage returns the Swift name of message within its
+// container, prefixed when it is top-level.
+func (n *Namer) RelativeNameOfMessage(message protoreflect.MessageDescriptor) string {
+	if name, ok := n.NameOverride(message); ok {
+		return name
+	}
+	if n.opts.LowerCaseMessages {
+		return n.Transform(string(message.Name()), false)
+	}
+	if _, ok := message.Parent().(protoreflect.MessageDescriptor); ok {
+		return n.SanitizeMessage(string(message.Name()))
+	} else {
+		prefix := n.TopLevelPrefix(message)
+		return n.SanitizeMessage(prefix + string(message.Name()))
+	}
+}
+
+// NameOverride returns the string value of the Options.NameOption extension set
+// on message, if any. The extension is not linked in, so it is read
+// from the unknown fields of the message options.
+func (n *Namer) NameOverride(message protoreflect.MessageDescriptor) (string, bool) {
+	if n.opts.NameOption == 0 {
+		return "", false
+	}
+	options, ok := message.Options().(*descriptorpb.MessageOptions)
+	if !ok || options == nil {
+		return "", false
+	}
+	name, found := "", false
+	b := options.ProtoReflect().GetUnknown()
+	for len(b) > 0 {
+		num, typ, l := protowire.ConsumeTag(b)
+		if l < 0 {
+			return "", false
+		}
+		b = b[l:]
+		if num == n.opts.NameOption && typ == protowire.BytesType {
+			v, m := protowire.ConsumeBytes(b)
+			if m < 0 {
+				return "", false
+			}
+			name, found = string(v), true
+		}
+		l = protowire.ConsumeFieldValue(num, typ, b)
+		if l < 0 {
+			return "", false
+		}
+		b = b[l:]
+	}
+	return name, found
+}
+
+// FullNameOfEnum is FullNameOfMessage for enums.
+func (n *Namer) FullNameOfEnum(enum protoreflect.EnumDescriptor) string {
+	relativeName := n.RelativeNameOfEnum(enum)
+	if container, ok := enum.Parent().(protoreflect.MessageDescriptor); ok {
+		return n.FullNameOfMessage(container) + n.opts.Separator + relativeName
+	} else {
+		return relativeName
+	}
+}
+
+// RelativeNameOfEnum is RelativeNameOfMessage for enums. Like SwiftProtobuf,
+// it only uses the Enum disambiguator for nested enums: a top-level enum is
+// sanitized as a message, so an unprefixed enum Type becomes TypeMessage.
+func (n *Namer) RelativeNameOfEnum(enum protoreflect.EnumDescriptor) string {
+	if _, ok := enum.Parent().(protoreflect.MessageDescriptor); ok {
+		return n.SanitizeEnum(string(enum.Name()))
+	} else {
+		prefix := n.TopLevelPrefix(enum)
+		return n.SanitizeMessage(prefix + string(enum.Name()))
+	}
+}
+
+// FullNameOfOneof returns the Swift name of the enum generated for oneof.
+func (n *Namer) FullNameOfOneof(oneof protoreflect.OneofDescriptor) (string, error) {
+	container, ok := oneof.Parent().(protoreflect.MessageDescriptor)
+	if !ok {
+		return "", fmt.Errorf("oneof %s is not declared in a message", oneof.FullName())
+	}
+	return n.FullNameOfMessage(container) + n.opts.Separator + n.RelativeNameOfOneof(oneof), nil
+}
+
+// RelativeNameOfOneof returns the name of the OneOf_ enum generated for oneof
+// within its message.
+func (n *Namer) RelativeNameOfOneof(oneof protoreflect.OneofDescriptor) string {
+	camelCase := n.ToUpperCamelCase(string(oneof.Name()))
+	return n.SanitizeOneof("OneOf_" + camelCase)
+}
+
+// FullNameOfField returns the Swift name of the property generated for field.
+func (n *Namer) FullNameOfField(field protoreflect.FieldDescriptor) string {
+	return n.FullNameOfMessage(field.ContainingMessage()) + n.opts.Separator + n.RelativeNameOfField(field)
+}
+
+// RelativeNameOfField names a group field after its group type, as
+// SwiftProtobuf does: the proto field name is the lowercased type name and
+// would lose its camel case, so group MyGroup becomes myGroup, not mygroup.
+func (n *Namer) RelativeNameOfField(field protoreflect.FieldDescriptor) string {
+	name := string(field.Name())
+	if field.Kind() == protoreflect.GroupKind {
+		name = string(field.Message().Name())
+	}
+	return n.SanitizeField(n.ToLowerCamelCase(name))
+}
+
+// AccessorNamesOfField returns the names of the hasFoo and clearFoo
+// accessors SwiftProtobuf generates for a field with presence, built from
+// the field's name like its property. ok is false for fields without them:
+// fields without presence and members of a real oneof. An accessor name that
+// is also the property name of another field of the message, as hasFoo is
+// for a field has_foo, gets the _p suffix.
+func (n *Namer) AccessorNamesOfField(field protoreflect.FieldDescriptor) (has, clear string, ok bool) {
+	if !field.HasPresence() {
+		return "", "", false
+	}
+	if oneof := field.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+		return "", "", false
+	}
+	name := string(field.Name())
+	if field.Kind() == protoreflect.GroupKind {
+		name = string(field.Message().Name())
+	}
+	upper := n.ToUpperCamelCase(name)
+	properties := make(map[string]bool)
+	if message := field.ContainingMessage(); message != nil {
+		fields := message.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			if other := fields.Get(i); other != field {
+				properties[n.RelativeNameOfField(other)] = true
+			}
+		}
+	}
+	escape := func(accessor string) string {
+		if properties[accessor] {
+			return accessor + "_p"
+		}
+		return accessor
+	}
+	return escape("has" + upper), escape("clear" + upper), true
+}
+
+// FullNameOfEnumValue returns the Swift name of the case generated for value.
+func (n *Namer) FullNameOfEnumValue(value protoreflect.EnumValueDescriptor) (string, error) {
+	enum, ok := value.Parent().(protoreflect.EnumDescriptor)
+	if !ok {
+		return "", fmt.Errorf("enum value %s is not declared in an enum", value.FullName())
+	}
+	return n.FullNameOfEnum(enum) + n.opts.Separator + n.RelativeNameOfEnumValue(value), nil
+}
+
+// RelativeNameOfEnumValue drops the enum's name from the front of the value
+// name, as SwiftProtobuf does, so Kind.KIND_FOO_BAR becomes fooBar. When the
+// value doesn't start with the enum name, or stripping it would leave nothing
+// or a leading digit, the whole value name is used instead. Reserved results
+// such as self or default are disambiguated like field names.
+func (n *Namer) RelativeNameOfEnumValue(value protoreflect.EnumValueDescriptor) string {
+	stripped := stripEnumPrefix(string(value.Parent().Name()), string(value.Name()))
+	if len(stripped) > 0 && ToCharKind([]rune(stripped)[0]) != Digit {
+		return n.SanitizeEnumValue(n.ToLowerCamelCase(stripped))
+	}
+	return n.SanitizeEnumValue(n.ToLowerCamelCase(string(value.Name())))
+}
+
+// stripEnumPrefix removes prefix from the front of name, comparing case
+// insensitively and skipping underscores in name, so FooBar matches
+// FOO_BAR_BAZ. Underscores following the prefix are removed too. It returns
+// "" when name does not start with prefix.
+func stripEnumPrefix(prefix, name string) string {
+	nameRunes := []rune(name)
+	i := 0
+	for _, p := range prefix {
+		for i < len(nameRunes) && nameRunes[i] == '_' {
+			i++
+		}
+		if i == len(nameRunes) || unicode.ToLower(nameRunes[i]) != unicode.ToLower(p) {
+			return ""
+		}
+		i++
+	}
+	for i < len(nameRunes) && nameRunes[i] == '_' {
+		i++
+	}
+	return string(nameRunes[i:])
+}
+
+// RelativeNameOfService is prefixed like a top-level message; services can't
+// be nested.
+func (n *Namer) RelativeNameOfService(service protoreflect.ServiceDescriptor) string {
+	prefix := n.TopLevelPrefix(service)
+	return n.SanitizeService(prefix + string(service.Name()))
+}
+
+// FullNameOfMethod returns the Swift name of method within its service.
+func (n *Namer) FullNameOfMethod(method protoreflect.MethodDescriptor) (string, error) {
+	service, ok := method.Parent().(protoreflect.ServiceDescriptor)
+	if !ok {
+		return "", fmt.Errorf("method %s is not declared in a service", method.FullName())
+	}
+	return n.RelativeNameOfService(service) + n.opts.Separator + n.RelativeNameOfMethod(method), nil
+}
+
+// RelativeNameOfMethod returns the lowerCamelCase name of method within its
+// service.
+func (n *Namer) RelativeNameOfMethod(method protoreflect.MethodDescriptor) string {
+	return n.SanitizeMethod(n.ToLowerCamelCase(string(method.Name())))
+}
+
+// SanitizeMessage disambiguates a message name with the Message suffix.
+func (n *Namer) SanitizeMessage(name string) string {
+	return n.SanitizeTypeName(n.stripLeadingUnderscores(name), "Message")
+}
+
+// SanitizeEnum disambiguates a nested enum name with the Enum suffix.
+func (n *Namer) SanitizeEnum(name string) string {
+	return n.SanitizeTypeName(n.stripLeadingUnderscores(name), "Enum")
+}
+
+// stripLeadingUnderscores removes the leading underscores of a type name when
+// Options.StripLeadingUnderscore is set. Names that would be left empty or start
+// with a digit are kept as they are, so the result stays a valid identifier.
+func (n *Namer) stripLeadingUnderscores(name string) string {
+	if !n.opts.StripLeadingUnderscore {
+		return name
+	}
+	stripped := strings.TrimLeft(name, "_")
+	if len(stripped) == 0 || unicode.IsDigit(rune(stripped[0])) {
+		return name
+	}
+	return stripped
+}
+
+// SanitizeOneof disambiguates a OneOf_ enum name with the Oneof suffix.
+func (n *Namer) SanitizeOneof(name string) string {
+	return n.SanitizeTypeName(name, "Oneof")
+}
+
+// SanitizeField disambiguates Swift keywords and reserved names; a field made
+// only of underscores, such as `_`, becomes `_Field` rather than a wildcard.
+func (n *Namer) SanitizeField(name string) string {
+	return n.SanitizeTypeName(name, "Field")
+}
+
+// SanitizeEnumValue disambiguates an enum case name with the Value suffix.
+func (n *Namer) SanitizeEnumValue(name string) string {
+	return n.SanitizeTypeName(name, "Value")
+}
+
+// SanitizeService disambiguates a service name with the Service suffix.
+func (n *Namer) SanitizeService(name string) string {
+	return n.SanitizeTypeName(n.stripLeadingUnderscores(name), "Service")
+}
+
+// SanitizeMethod disambiguates a method name with the Method suffix.
+func (n *Namer) SanitizeMethod(name string) string {
+	return n.SanitizeTypeName(name, "Method")
+}
+
+// SanitizeTypeName appends disambiguator to reserved names. A name already
+// ending in disambiguator gets another one when its stem needs one, so an enum
+// TypeEnum becomes TypeEnumEnum and can't clash with the enum Type, which
+// becomes TypeEnum, just as in SwiftProtobuf.
+func (n *Namer) SanitizeTypeName(name, disambiguator string) string {
+	if n.isReserved(name) {
+		return name + disambiguator
+	} else if isAllUnderscore(name) {
+		return name + disambiguator
+	} else if strings.HasSuffix(name, disambiguator) {
+		return n.SanitizeTypeName(name[:len(name)-len(disambiguator)], disambiguator) + disambiguator
+	}
+	return name
+}
+
+// isReserved reports whether name is a reserved name, ignoring case under
+// Options.CIReserved.
+func (n *Namer) isReserved(name string) bool {
+	return n.reserved[n.reservedKey(name)]
+}
+
+func (n *Namer) reservedKey(name string) string {
+	if n.opts.CIReserved {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+func isAllUnderscore(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for _, s := range name {
+		if s != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// TopLevelPrefix is prepended to the name of a top-level message, enum or
+// service: the file's type prefix, unless Options.NoPrefix is set, combined
+// with the Options.KindPrefix* field for its kind.
+func (n *Namer) TopLevelPrefix(desc protoreflect.Descriptor) string {
+	kindPrefix := ""
+	switch desc.(type) {
+	case protoreflect.MessageDescriptor:
+		kindPrefix = n.opts.KindPrefixMessage
+	case protoreflect.EnumDescriptor:
+		kindPrefix = n.opts.KindPrefixEnum
+	}
+	filePrefix := ""
+	if !n.opts.NoPrefix {
+		filePrefix = n.TypePrefix(desc.ParentFile())
+	}
+	if n.opts.KindPrefixFirst {
+		return kindPrefix + filePrefix
+	}
+	return filePrefix + kindPrefix
+}
+
+// TypePrefix returns the prefix of the top-level types of file: its
+// swift_prefix option if set, then its objc_class_prefix under
+// Options.ObjcPrefixFallback, else one derived from its package.
+func (n *Namer) TypePrefix(file protoreflect.FileDescriptor) string {
+	if file == n.file {
+		return n.filePrefix
+	}
+	return n.typePrefixInternal(string(file.Package()), file.Options().(*descriptorpb.FileOptions))
+}
+
+// ForFile returns a Namer like n that computes the type prefix of file only
+// once, for naming the many types file may declare. Types of other files,
+// such as those file's fields refer to, are named as by n.
+func (n *Namer) ForFile(file protoreflect.FileDescriptor) *Namer {
+	forFile := *n
+	forFile.file = file
+	forFile.filePrefix = n.TypePrefix(file)
+	return &forFile
+}
+
+func (n *Namer) typePrefixInternal(packageName string, options *descriptorpb.FileOptions) string {
+	swiftPrefix := options.GetSwiftPrefix()
+	if len(swiftPrefix) > 0 {
+		return swiftPrefix
+	}
+	if n.opts.ObjcPrefixFallback && packageName != "google.protobuf" {
+		if objcPrefix := options.GetObjcClassPrefix(); len(objcPrefix) > 0 {
+			return objcPrefix
+		}
+	}
+	if len(packageName) == 0 {
+		packageName = n.opts.DefaultPrefix
+	}
+	if len(packageName) == 0 {
+		return ""
+	}
+	ret := make([]rune, 0, len(packageName)+1)
+	makeUpper := true
+	for _, c := range packageName {
+		if c == '_' {
+			makeUpper = true
+		} else if c == '.' {
+			makeUpper = true
+			ret = append(ret, '_')
+		} else {
+			if len(ret) == 0 && unicode.IsNumber(c) {
+				ret = append(ret, '_')
+			}
+			if makeUpper {
+				ret = append(ret, unicode.ToUpper(c))
+				makeUpper = false
+			} else {
+				ret = append(ret, c)
+			}
+		}
+	}
+	return string(ret) + n.opts.PrefixSeparator
+}
+
+// ToUpperCamelCase is Transform with an initial uppercase letter.
+func (n *Namer) ToUpperCamelCase(name string) string {
+	return n.Transform(name, true)
+}
+
+// ToLowerCamelCase is Transform with an initial lowercase letter.
+func (n *Namer) ToLowerCamelCase(name string) string {
+	return n.Transform(name, false)
+}
+
+// RegisterReserved adds names the sanitizer must disambiguate, on top of the
+// Swift keywords and SwiftProtobuf names built in, for the Namers created
+// afterwards. It is meant to be called from an init function, for instance in
+// a file built only with a custom build tag, and must not run concurrently
+// with New.
+func RegisterReserved(names ...string) {
+	for _, name := range names {
+		reservedNames[name] = true
+	}
+}
+
+// RegisterAbbreviations adds words to the built-in abbreviations, like url
+// and id, for the Namers created afterwards. Like RegisterReserved it must be
+// called from an init function.
+func RegisterAbbreviations(words ...string) {
+	for _, word := range words {
+		abbreviations[strings.ToLower(word)] = true
+	}
+}
+
+var abbreviations = map[string]bool{
+	"url":   true,
+	"http":  true,
+	"https": true,
+	"id":    true,
+}
+
+// CharKind classifies the characters of a name for Transform.
+type CharKind int
+
+// The character kinds Transform splits names at. Digit, Lower and Upper only
+// cover ASCII; every other character but the underscore is Other.
+const (
+	Digit CharKind = iota
+	Lower
+	Upper
+	Underscore
+	Other
+)
+
+// ToCharKind returns the kind of c.
+func ToCharKind(c rune) CharKind {
+	switch {
+	case c >= '0' && c <= '9':
+		return Digit
+	case c >= 'a' && c <= 'z':
+		return Lower
+	case c >= 'A' && c <= 'Z':
+		return Upper
+	case c == '_':
+		return Underscore
+	default:
+		return Other
+	}
+}
+
+// Transform camel-cases a proto name the way SwiftProtobuf does, escaping
+// characters Swift identifiers can't hold.
+//
+// An underscore only separates words, so a single leading underscore is
+// dropped: _a becomes a. Each further underscore in a run is kept, and the
+// word after it is capitalized even in lower camel case, since it no longer
+// starts the result: __a becomes _A and ___a becomes __A. This matches
+// SwiftProtobuf's NamingUtils.
+func (n *Namer) Transform(name string, initialUpperCase bool) string {
+	result, _ := n.TransformEscaping(name, initialUpperCase)
+	return result
+}
+
+// TransformEscaping is transform, also reporting whether any character had
+// to be escaped as _u<codepoint>.
+func (n *Namer) TransformEscaping(name string, initialUpperCase bool) (string, bool) {
+	result := new(strings.Builder)
+	var current []rune
+	lastKind := Other
+	escaped := false
+
+	addCurrent := func() {
+		if len(current) == 0 {
+			return
+		}
+		currentAsString := string(current)
+		if result.Len() == 0 && !initialUpperCase {
+			// Nothing, want it to stay lowercase.
+		} else if n.abbreviations[currentAsString] {
+			currentAsString = strings.ToUpper(currentAsString)
+		} else {
+			currentAsString = uppercaseFirstCharacter(currentAsString)
+		}
+		result.WriteString(currentAsString)
+		current = current[:0]
+	}
+
+	for _, c := range name {
+		kind := ToCharKind(c)
+		switch kind {
+		case Digit:
+			if lastKind != Digit {
+				addCurrent()
+			}
+			if result.Len() == 0 {
+				result.WriteRune('_')
+			} else if n.opts.NumberSeparator && lastKind != Digit {
+				result.WriteRune('_')
+			}
+			current = append(current, c)
+
+		case Upper:
+			if lastKind != Upper {
+				addCurrent()
+			}
+			current = append(current, unicode.ToLower(c))
+
+		case Lower:
+			if lastKind != Lower && lastKind != Upper {
+				addCurrent()
+			}
+			current = append(current, c)
+
+		case Underscore:
+			addCurrent()
+			if lastKind == Underscore {
+				result.WriteRune('_')
+			}
+
+		case Other:
+			addCurrent()
+			escapeIt := false
+			if result.Len() == 0 {
+				escapeIt = !isSwiftIdentifierHeadCharacter(c)
+			} else {
+				escapeIt = !isSwiftIdentifierCharacter(c)
+			}
+			if escapeIt {
+				_, _ = fmt.Fprintf(result, "_u%d", c)
+				escaped = true
+			} else {
+				current = append(current, c)
+			}
+
+		default:
+			panic("can't reach here")
+		}
+
+		lastKind = kind
+	}
+	// Add the last segment collected.
+	addCurrent()
+
+	// If things end in an underscore, add one also.
+	if lastKind == Underscore {
+		result.WriteRune('_')
+	}
+
+	return result.String(), escaped
+}
+
+func uppercaseFirstCharacter(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	ret := []rune(s)
+	ret[0] = unicode.ToUpper(ret[0])
+	return string(ret)
+}
+
+// IsSwiftIdentifier reports whether s is a valid Swift identifier.
+func IsSwiftIdentifier(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i, c := range []rune(s) {
+		if i == 0 && !isSwiftIdentifierHeadCharacter(c) {
+			return false
+		} else if i > 0 && !isSwiftIdentifierCharacter(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSwiftIdentifierHeadCharacter(c rune) bool {
+	switch {
+	case (c >= 0x61 && c <= 0x7a) || (c >= 0x41 && c <= 0x5a):
+		fallthrough
+	case c == 0x5f:
+		fallthrough
+	case (c == 0xa8) || (c == 0xaa) || (c == 0xad) || (c == 0xaf) || (c >= 0xb2 && c <= 0xb5) || (c >= 0xb7 && c <= 0xba):
+		fallthrough
+	case (c >= 0xbc && c <= 0xbe) || (c >= 0xc0 && c <= 0xd6) || (c >= 0xd8 && c <= 0xf6) || (c >= 0xf8 && c <= 0xff):
+		fallthrough
+	case (c >= 0x100 && c <= 0x2ff) || (c >= 0x370 && c <= 0x167f) || (c >= 0x1681 && c <= 0x180d) || (c >= 0x180f && c <= 0x1dbf):
+		fallthrough
+	case c >= 0x1e00 && c <= 0x1fff:
+		fallthrough
+	case (c >= 0x200b && c <= 0x200d) || (c >= 0x202a && c <= 0x202e) || (c == 0x203F) || (c == 0x2040) || (c == 0x2054) || (c >= 0x2060 && c <= 0x206f):
+		fallthrough
+	case (c >= 0x2070 && c <= 0x20cf) || (c >= 0x2100 && c <= 0x218f) || (c >= 0x2460 && c <= 0x24ff) || (c >= 0x2776 && c <= 0x2793):
+		fallthrough
+	case (c >= 0x2c00 && c <= 0x2dff) || (c >= 0x2e80 && c <= 0x2fff):
+		fallthrough
+	case (c >= 0x3004 && c <= 0x3007) || (c >= 0x3021 && c <= 0x302f) || (c >= 0x3031 && c <= 0x303f) || (c >= 0x3040 && c <= 0xd7ff):
+		fallthrough
+	case (c >= 0xf900 && c <= 0xfd3d) || (c >= 0xfd40 && c <= 0xfdcf) || (c >= 0xfdf0 && c <= 0xfe1f) || (c >= 0xfe30 && c <= 0xfe44):
+		fallthrough
+	case c >= 0xfe47 && c <= 0xfffd:
+		fallthrough
+	case (c >= 0x10000 && c <= 0x1fffd) || (c >= 0x20000 && c <= 0x2fffd) || (c >= 0x30000 && c <= 0x3fffd) || (c >= 0x40000 && c <= 0x4fffd):
+		fallthrough
+	case (c >= 0x50000 && c <= 0x5fffd) || (c >= 0x60000 && c <= 0x6fffd) || (c >= 0x70000 && c <= 0x7fffd) || (c >= 0x80000 && c <= 0x8fffd):
+		fallthrough
+	case (c >= 0x90000 && c <= 0x9fffd) || (c >= 0xa0000 && c <= 0xafffd) || (c >= 0xb0000 && c <= 0xbfffd) || (c >= 0xc0000 && c <= 0xcfffd):
+		fallthrough
+	case (c >= 0xd0000 && c <= 0xdfffd) || (c >= 0xe0000 && c <= 0xefffd):
+		return true
+
+	default:
+		return false
+	}
+}
+
+func isSwiftIdentifierCharacter(c rune) bool {
+	switch {
+	case c >= 0x30 && c <= 0x39:
+		fallthrough
+	case (c >= 0x300 && c <= 0x36F) || (c >= 0x1dc0 && c <= 0x1dff) || (c >= 0x20d0 && c <= 0x20ff) || (c >= 0xfe20 && c <= 0xfe2f):
+		return true
+
+	default:
+		return isSwiftIdentifierHeadCharacter(c)
+	}
+}
+
+var reservedNames = map[string]bool{
+	"SwiftProtobuf":    true,
+	"Extensions":       true,
+	"protoMessageName": true,
+	"decodeMessage":    true,
+	"traverse":         true,
+	"isInitialized":    true,
+	"unknownFields":    true,
+	"debugDescription": true,
+	"description":      true,
+	"dynamicType":      true,
+	"hashValue":        true,
+	"Type":             true,
+	"Protocol":         true,
+}
+
+var swiftKeywordsUsedInDeclarations = []string{
+	"associatedtype", "class", "deinit", "enum", "extension",
+	"fileprivate", "func", "import", "init", "inout", "internal",
+	"let", "open", "operator", "private", "protocol", "public",
+	"static", "struct", "subscript", "typealias", "var",
+}
+
+var swiftKeywordsUsedInStatements = []string{
+	"break", "case",
+	"continue", "default", "defer", "do", "else", "fallthrough",
+	"for", "guard", "if", "in", "repeat", "return", "switch", "where",
+	"while",
+}
+
+var swiftKeywordsUsedInExpressionsAndTypes = []string{
+	"as",
+	"Any", "catch", "false", "is", "nil", "rethrows", "super", "self",
+	"Self", "throw", "throws", "true", "try",
+}
+
+var swiftCommonTypes = []string{
+	"Bool", "Data", "Double", "Float", "Int",
+	"Int32", "Int64", "String", "UInt", "UInt32", "UInt64",
+}
+
+var swiftSpecialVariables = []string{
+	"__COLUMN__",
+	"__FILE__", "__FUNCTION__", "__LINE__",
+}
+
+func init() {
+	for _, keyword := range swiftKeywordsUsedInDeclarations {
+		reservedNames[keyword] = true
+	}
+	for _, keyword := range swiftKeywordsUsedInStatements {
+		reservedNames[keyword] = true
+	}
+	for _, keyword := range swiftKeywordsUsedInExpressionsAndTypes {
+		reservedNames[keyword] = true
+	}
+	for _, commonType := range swiftCommonTypes {
+		reservedNames[commonType] = true
+	}
+	for _, variable := range swiftSpecialVariables {
+		reservedNames[variable] = true
+	}
+}
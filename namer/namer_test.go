@@ -0,0 +1,654 @@
+package namer
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// newFile builds the file described by the FileDescriptorProto in text
+// format.
+func newFile(t *testing.T, text string) protoreflect.FileDescriptor {
+	fileProto := new(descriptorpb.FileDescriptorProto)
+	if err := prototext.Unmarshal([]byte(text), fileProto); err != nil {
+		t.Fatal(err)
+	}
+	file, err := protodesc.NewFile(fileProto, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// find returns the descriptor of file with the given full name.
+func find(t *testing.T, file protoreflect.FileDescriptor, name protoreflect.FullName) protoreflect.Descriptor {
+	files := new(protoregistry.Files)
+	if err := files.RegisterFile(file); err != nil {
+		t.Fatal(err)
+	}
+	desc, err := files.FindDescriptorByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return desc
+}
+
+func TestTransform(t *testing.T) {
+	n := New(DefaultOptions())
+	tests := []struct {
+		name  string
+		upper string
+		lower string
+	}{
+		{"HTTPRequest", "Httprequest", "httprequest"},
+		{"url_id", "URLID", "urlID"},
+		{"_private", "Private", "private"},
+		{"123abc", "_123Abc", "_123Abc"},
+		{"foo__bar", "Foo_Bar", "foo_Bar"},
+		{"foo🙂bar", "Foo🙂Bar", "foo🙂Bar"},
+		{"🙂foo", "🙂Foo", "🙂Foo"},
+		{"trailing_", "Trailing_", "trailing_"},
+		{"trailing__", "Trailing__", "trailing__"},
+		{"aByte", "AByte", "aByte"},
+		{"xRay", "XRay", "xRay"},
+		{"iOS", "IOs", "iOs"},
+		{"aB", "AB", "aB"},
+		{"v1alpha2", "V1Alpha2", "v1Alpha2"},
+		{"v2beta1", "V2Beta1", "v2Beta1"},
+		{"api2", "Api2", "api2"},
+		{"fooV2", "FooV2", "fooV2"},
+	}
+	for _, test := range tests {
+		if got := n.Transform(test.name, true); got != test.upper {
+			t.Errorf("Transform(%q, true) = %q, want %q", test.name, got, test.upper)
+		}
+		if got := n.Transform(test.name, false); got != test.lower {
+			t.Errorf("Transform(%q, false) = %q, want %q", test.name, got, test.lower)
+		}
+	}
+}
+
+// TestTransformLeadingUnderscores pins the rule documented on Transform: the
+// first underscore of a leading run is dropped and each further one kept.
+func TestTransformLeadingUnderscores(t *testing.T) {
+	n := New(DefaultOptions())
+	tests := []struct {
+		name  string
+		upper string
+		lower string
+	}{
+		{"_a", "A", "a"},
+		{"__a", "_A", "_A"},
+		{"___a", "__A", "__A"},
+	}
+	for _, test := range tests {
+		if got := n.Transform(test.name, true); got != test.upper {
+			t.Errorf("Transform(%q, true) = %q, want %q", test.name, got, test.upper)
+		}
+		if got := n.Transform(test.name, false); got != test.lower {
+			t.Errorf("Transform(%q, false) = %q, want %q", test.name, got, test.lower)
+		}
+	}
+}
+
+func TestTransformNumberSeparator(t *testing.T) {
+	tests := []struct {
+		separator bool
+		name      string
+		upper     string
+		lower     string
+	}{
+		{false, "foo2bar", "Foo2Bar", "foo2Bar"},
+		{false, "foo2", "Foo2", "foo2"},
+		{false, "2foo", "_2Foo", "_2Foo"},
+		{true, "foo2bar", "Foo_2Bar", "foo_2Bar"},
+		{true, "foo2", "Foo_2", "foo_2"},
+		// A leading digit run gets a single underscore either way.
+		{true, "2foo", "_2Foo", "_2Foo"},
+	}
+	for _, test := range tests {
+		opts := DefaultOptions()
+		opts.NumberSeparator = test.separator
+		n := New(opts)
+		if got := n.Transform(test.name, true); got != test.upper {
+			t.Errorf("NumberSeparator=%v: Transform(%q, true) = %q, want %q", test.separator, test.name, got, test.upper)
+		}
+		if got := n.Transform(test.name, false); got != test.lower {
+			t.Errorf("NumberSeparator=%v: Transform(%q, false) = %q, want %q", test.separator, test.name, got, test.lower)
+		}
+	}
+}
+
+func TestTransformAbbreviations(t *testing.T) {
+	tests := []struct {
+		opts  Options
+		name  string
+		upper string
+		lower string
+	}{
+		{DefaultOptions(), "url", "URL", "url"},
+		{DefaultOptions(), "http", "HTTP", "http"},
+		{DefaultOptions(), "https", "HTTPS", "https"},
+		{DefaultOptions(), "id", "ID", "id"},
+		{DefaultOptions(), "user_id_url", "UserIDURL", "userIDURL"},
+		{DefaultOptions(), "http_https_id", "HTTPHTTPSID", "httpHTTPSID"},
+		{DefaultOptions(), "url_idx", "URLIdx", "urlIdx"},
+		{DefaultOptions(), "identity", "Identity", "identity"},
+		{Options{Abbreviations: []string{"API"}}, "api_url", "APIURL", "apiURL"},
+		{Options{Abbreviations: []string{"api"}, ReplaceAbbreviations: true}, "api_url", "APIUrl", "apiUrl"},
+	}
+	for _, test := range tests {
+		n := New(test.opts)
+		if got := n.Transform(test.name, true); got != test.upper {
+			t.Errorf("Transform(%q, true) = %q, want %q", test.name, got, test.upper)
+		}
+		if got := n.Transform(test.name, false); got != test.lower {
+			t.Errorf("Transform(%q, false) = %q, want %q", test.name, got, test.lower)
+		}
+	}
+}
+
+func TestFullNameOfEnum(t *testing.T) {
+	n := New(DefaultOptions())
+	file := newFile(t, `
+		name: "nested.proto"
+		package: "foo.bar"
+		message_type {
+			name: "Outer"
+			nested_type {
+				name: "Middle"
+				nested_type {
+					name: "Inner"
+					enum_type { name: "Kind" value { name: "KIND_UNKNOWN" number: 0 } }
+				}
+				enum_type { name: "Kind" value { name: "KIND_UNKNOWN" number: 0 } }
+			}
+		}
+		enum_type { name: "Kind" value { name: "KIND_UNKNOWN" number: 0 } }
+	`)
+	tests := []struct {
+		name protoreflect.FullName
+		want string
+	}{
+		{"foo.bar.Kind", "Foo_Bar_Kind"},
+		{"foo.bar.Outer.Middle.Kind", "Foo_Bar_Outer.Middle.Kind"},
+		{"foo.bar.Outer.Middle.Inner.Kind", "Foo_Bar_Outer.Middle.Inner.Kind"},
+	}
+	for _, test := range tests {
+		enum := find(t, file, test.name).(protoreflect.EnumDescriptor)
+		if got := n.FullNameOfEnum(enum); got != test.want {
+			t.Errorf("FullNameOfEnum(%s) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+// TestFullNameOfEnumDisambiguators checks that each level of a nested name is
+// sanitized on its own, so disambiguators don't stack across levels, and that
+// top-level enums are sanitized as messages.
+func TestFullNameOfEnumDisambiguators(t *testing.T) {
+	n := New(DefaultOptions())
+	file := newFile(t, `
+		name: "reserved.proto"
+		message_type {
+			name: "Type"
+			nested_type {
+				name: "Type"
+				nested_type {
+					name: "Type"
+					enum_type { name: "Type" value { name: "A" number: 0 } }
+					enum_type { name: "TypeEnum" value { name: "B" number: 0 } }
+				}
+			}
+			enum_type { name: "TypeEnum" value { name: "C" number: 0 } }
+		}
+		enum_type { name: "Protocol" value { name: "D" number: 0 } }
+		enum_type { name: "TypeEnum" value { name: "E" number: 0 } }
+	`)
+	tests := []struct {
+		name protoreflect.FullName
+		want string
+	}{
+		{"Type.TypeEnum", "TypeMessage.TypeEnumEnum"},
+		{"Type.Type.Type.Type", "TypeMessage.TypeMessage.TypeMessage.TypeEnum"},
+		{"Type.Type.Type.TypeEnum", "TypeMessage.TypeMessage.TypeMessage.TypeEnumEnum"},
+		{"Protocol", "ProtocolMessage"},
+		{"TypeEnum", "TypeEnum"},
+	}
+	for _, test := range tests {
+		enum := find(t, file, test.name).(protoreflect.EnumDescriptor)
+		if got := n.FullNameOfEnum(enum); got != test.want {
+			t.Errorf("FullNameOfEnum(%s) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+// TestSanitizeMessage pins message names made of the disambiguator itself,
+// which the sanitizer strips and adds back.
+func TestSanitizeMessage(t *testing.T) {
+	n := New(DefaultOptions())
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Message", "Message"},
+		{"MessageMessage", "MessageMessage"},
+		{"Enum", "Enum"},
+		{"Type", "TypeMessage"},
+	}
+	for _, test := range tests {
+		if got := n.SanitizeMessage(test.name); got != test.want {
+			t.Errorf("SanitizeMessage(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCIReserved(t *testing.T) {
+	tests := []struct {
+		ci   bool
+		name string
+		want string
+	}{
+		{false, "Description", "Description"},
+		{false, "description", "descriptionMessage"},
+		{false, "DESCRIPTION", "DESCRIPTION"},
+		{true, "Description", "DescriptionMessage"},
+		{true, "description", "descriptionMessage"},
+		{true, "DESCRIPTION", "DESCRIPTIONMessage"},
+	}
+	for _, test := range tests {
+		opts := DefaultOptions()
+		opts.CIReserved = test.ci
+		n := New(opts)
+		if got := n.SanitizeMessage(test.name); got != test.want {
+			t.Errorf("CIReserved=%v: SanitizeMessage(%q) = %q, want %q", test.ci, test.name, got, test.want)
+		}
+	}
+}
+
+// TestRegister checks that registered names and words apply to the Namers
+// created afterwards only. It removes them again, since they change the
+// package defaults.
+func TestRegister(t *testing.T) {
+	before := New(DefaultOptions())
+	RegisterReserved("Widget")
+	RegisterAbbreviations("GPU")
+	defer func() {
+		delete(reservedNames, "Widget")
+		delete(abbreviations, "gpu")
+	}()
+	after := New(DefaultOptions())
+
+	if got, want := before.SanitizeMessage("Widget"), "Widget"; got != want {
+		t.Errorf("before: SanitizeMessage(Widget) = %q, want %q", got, want)
+	}
+	if got, want := after.SanitizeMessage("Widget"), "WidgetMessage"; got != want {
+		t.Errorf("after: SanitizeMessage(Widget) = %q, want %q", got, want)
+	}
+	if got, want := before.ToUpperCamelCase("gpu_id"), "GpuID"; got != want {
+		t.Errorf("before: ToUpperCamelCase(gpu_id) = %q, want %q", got, want)
+	}
+	if got, want := after.ToUpperCamelCase("gpu_id"), "GPUID"; got != want {
+		t.Errorf("after: ToUpperCamelCase(gpu_id) = %q, want %q", got, want)
+	}
+}
+
+// TestFullNameOfOneof checks that a oneof reuses the disambiguated name of
+// its message.
+func TestFullNameOfOneof(t *testing.T) {
+	n := New(DefaultOptions())
+	file := newFile(t, `
+		name: "oneof.proto"
+		package: "prefix"
+		message_type {
+			name: "Outer"
+			nested_type {
+				name: "Type"
+				field { name: "a" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 oneof_index: 0 }
+				oneof_decl { name: "choice" }
+			}
+		}
+	`)
+	oneof := find(t, file, "prefix.Outer.Type.choice").(protoreflect.OneofDescriptor)
+	got, err := n.FullNameOfOneof(oneof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Prefix_Outer.TypeMessage.OneOf_Choice"; got != want {
+		t.Errorf("FullNameOfOneof(prefix.Outer.Type.choice) = %q, want %q", got, want)
+	}
+}
+
+func TestAccessorNamesOfField(t *testing.T) {
+	n := New(DefaultOptions())
+	file := newFile(t, `
+		name: "accessors.proto"
+		message_type {
+			name: "Node"
+			field { name: "child" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".Node" }
+			field { name: "has_child" number: 2 label: LABEL_OPTIONAL type: TYPE_BOOL }
+			field { name: "url_id" number: 3 label: LABEL_OPTIONAL type: TYPE_STRING }
+			field { name: "tags" number: 4 label: LABEL_REPEATED type: TYPE_STRING }
+			field { name: "text" number: 5 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+			oneof_decl { name: "value" }
+		}
+	`)
+	tests := []struct {
+		name  protoreflect.FullName
+		has   string
+		clear string
+		ok    bool
+	}{
+		{"Node.child", "hasChild_p", "clearChild", true},
+		{"Node.has_child", "hasHasChild", "clearHasChild", true},
+		{"Node.url_id", "hasURLID", "clearURLID", true},
+		{"Node.tags", "", "", false},
+		{"Node.text", "", "", false},
+	}
+	for _, test := range tests {
+		field := find(t, file, test.name).(protoreflect.FieldDescriptor)
+		has, clear, ok := n.AccessorNamesOfField(field)
+		if has != test.has || clear != test.clear || ok != test.ok {
+			t.Errorf("AccessorNamesOfField(%s) = %q, %q, %v, want %q, %q, %v", test.name, has, clear, ok, test.has, test.clear, test.ok)
+		}
+	}
+}
+
+func TestRelativeNameOfEnumValue(t *testing.T) {
+	n := New(DefaultOptions())
+	file := newFile(t, `
+		name: "values.proto"
+		package: "values"
+		enum_type {
+			name: "Status"
+			value { name: "ACTIVE" number: 0 }
+			value { name: "STATUS_OK" number: 1 }
+		}
+		enum_type {
+			name: "Foo"
+			value { name: "FOO_UNSPECIFIED" number: 0 }
+		}
+		enum_type {
+			name: "Mode"
+			value { name: "MODE" number: 0 }
+		}
+		enum_type {
+			name: "Keyword"
+			value { name: "self" number: 0 }
+			value { name: "Type" number: 1 }
+			value { name: "default" number: 2 }
+		}
+	`)
+	tests := []struct {
+		name protoreflect.FullName
+		want string
+	}{
+		// Without the STATUS_ prefix, the whole value name is used.
+		{"values.ACTIVE", "active"},
+		{"values.STATUS_OK", "ok"},
+		// The proto3 zero value convention.
+		{"values.FOO_UNSPECIFIED", "unspecified"},
+		// Stripping MODE from MODE would leave no name.
+		{"values.MODE", "mode"},
+		// Reserved names get the Value suffix; type is not reserved.
+		{"values.self", "selfValue"},
+		{"values.Type", "type"},
+		{"values.default", "defaultValue"},
+	}
+	for _, test := range tests {
+		value := find(t, file, test.name).(protoreflect.EnumValueDescriptor)
+		if got := n.RelativeNameOfEnumValue(value); got != test.want {
+			t.Errorf("RelativeNameOfEnumValue(%s) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRelativeNameOfField(t *testing.T) {
+	n := New(DefaultOptions())
+	file := newFile(t, `
+		name: "fields.proto"
+		package: "fields"
+		message_type {
+			name: "M"
+			field { name: "foo_" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 }
+			field { name: "foo__" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 }
+			field { name: "_" number: 3 label: LABEL_OPTIONAL type: TYPE_INT32 }
+			field { name: "mygroup" number: 4 label: LABEL_REPEATED type: TYPE_GROUP type_name: ".fields.M.MyGroup" }
+			nested_type {
+				name: "MyGroup"
+				field { name: "id" number: 5 label: LABEL_OPTIONAL type: TYPE_INT32 }
+			}
+		}
+	`)
+	tests := []struct {
+		name protoreflect.FullName
+		want string
+	}{
+		// Trailing underscores are kept as they are.
+		{"fields.M.foo_", "foo_"},
+		{"fields.M.foo__", "foo__"},
+		// A lone underscore is a reserved name.
+		{"fields.M._", "_Field"},
+		// A group field is named after its group type.
+		{"fields.M.mygroup", "myGroup"},
+	}
+	for _, test := range tests {
+		field := find(t, file, test.name).(protoreflect.FieldDescriptor)
+		if got := n.RelativeNameOfField(field); got != test.want {
+			t.Errorf("RelativeNameOfField(%s) = %q, want %q", test.name, got, test.want)
+		}
+	}
+	group := find(t, file, "fields.M.MyGroup").(protoreflect.MessageDescriptor)
+	if got, want := n.FullNameOfMessage(group), "Fields_M.MyGroup"; got != want {
+		t.Errorf("FullNameOfMessage(fields.M.MyGroup) = %q, want %q", got, want)
+	}
+}
+
+// The orphan descriptors claim their file as parent, as a descriptor
+// producer other than protoc could.
+type orphanOneof struct {
+	protoreflect.OneofDescriptor
+}
+
+func (o orphanOneof) Parent() protoreflect.Descriptor { return o.ParentFile() }
+
+type orphanEnumValue struct {
+	protoreflect.EnumValueDescriptor
+}
+
+func (v orphanEnumValue) Parent() protoreflect.Descriptor { return v.ParentFile() }
+
+type orphanMethod struct {
+	protoreflect.MethodDescriptor
+}
+
+func (m orphanMethod) Parent() protoreflect.Descriptor { return m.ParentFile() }
+
+// TestOrphanDescriptors checks that descriptors without the parent their kind
+// requires give an error naming them rather than a panic.
+func TestOrphanDescriptors(t *testing.T) {
+	n := New(DefaultOptions())
+	file := newFile(t, `
+		name: "orphans.proto"
+		package: "orphans"
+		message_type {
+			name: "Holder"
+			field { name: "text" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+			oneof_decl { name: "choice" }
+		}
+		enum_type { name: "Kind" value { name: "KIND_UNKNOWN" number: 0 } }
+		service { name: "Greeter" method { name: "Greet" input_type: ".orphans.Holder" output_type: ".orphans.Holder" } }
+	`)
+	tests := []struct {
+		name string
+		full func() (string, error)
+	}{
+		{"orphans.Holder.choice", func() (string, error) {
+			return n.FullNameOfOneof(orphanOneof{find(t, file, "orphans.Holder.choice").(protoreflect.OneofDescriptor)})
+		}},
+		{"orphans.KIND_UNKNOWN", func() (string, error) {
+			return n.FullNameOfEnumValue(orphanEnumValue{find(t, file, "orphans.KIND_UNKNOWN").(protoreflect.EnumValueDescriptor)})
+		}},
+		{"orphans.Greeter.Greet", func() (string, error) {
+			return n.FullNameOfMethod(orphanMethod{find(t, file, "orphans.Greeter.Greet").(protoreflect.MethodDescriptor)})
+		}},
+	}
+	for _, test := range tests {
+		name, err := test.full()
+		if err == nil || !strings.Contains(err.Error(), test.name) {
+			t.Errorf("naming orphan %s = %q, %v, want an error naming it", test.name, name, err)
+		}
+	}
+}
+
+func TestTypePrefix(t *testing.T) {
+	fallback := DefaultOptions()
+	fallback.ObjcPrefixFallback = true
+	tests := []struct {
+		file string
+		opts Options
+		want string
+	}{
+		{`name: "a.proto" package: "pa" options { swift_prefix: "SW" objc_class_prefix: "OC" }`, fallback, "SW"},
+		{`name: "b.proto" package: "pb" options { objc_class_prefix: "OC" }`, fallback, "OC"},
+		{`name: "c.proto" package: "pc"`, fallback, "Pc_"},
+		{`name: "b.proto" package: "pb" options { objc_class_prefix: "OC" }`, DefaultOptions(), "Pb_"},
+		{`name: "google/protobuf/empty.proto" package: "google.protobuf" options { objc_class_prefix: "GPB" }`, fallback, "Google_Protobuf_"},
+	}
+	for _, test := range tests {
+		file := newFile(t, test.file)
+		if got := New(test.opts).TypePrefix(file); got != test.want {
+			t.Errorf("TypePrefix(%s) = %q with ObjcPrefixFallback %v, want %q", file.Path(), got, test.opts.ObjcPrefixFallback, test.want)
+		}
+	}
+}
+
+func TestFullNameOfMessage(t *testing.T) {
+	noPrefix := DefaultOptions()
+	noPrefix.NoPrefix = true
+	strip := DefaultOptions()
+	strip.StripLeadingUnderscore = true
+	tests := []struct {
+		file string
+		opts Options
+		name protoreflect.FullName
+		want string
+	}{
+		// swift_prefix is used as given, with no underscore added.
+		{`name: "a.proto" options { swift_prefix: "MyApp" } message_type { name: "Foo" }`, DefaultOptions(), "Foo", "MyAppFoo"},
+		{`name: "b.proto" package: "example" message_type { name: "Foo" }`, DefaultOptions(), "example.Foo", "Example_Foo"},
+		{`name: "b.proto" package: "example" message_type { name: "Foo" }`, noPrefix, "example.Foo", "Foo"},
+		{`name: "c.proto" message_type { name: "_Foo" }`, DefaultOptions(), "_Foo", "_Foo"},
+		{`name: "c.proto" message_type { name: "_Foo" }`, strip, "_Foo", "Foo"},
+		{`name: "c.proto" message_type { name: "__Bar" }`, strip, "__Bar", "Bar"},
+		// A package prefix leaves no leading underscore to strip.
+		{`name: "c.proto" package: "f" message_type { name: "_Foo" }`, strip, "f._Foo", "F__Foo"},
+	}
+	for _, test := range tests {
+		file := newFile(t, test.file)
+		message := find(t, file, test.name).(protoreflect.MessageDescriptor)
+		if got := New(test.opts).FullNameOfMessage(message); got != test.want {
+			t.Errorf("FullNameOfMessage(%s) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+// TestNameOverride reads the override from unknown option bytes, which are
+// not validated before the plugin sees them.
+func TestNameOverride(t *testing.T) {
+	override := func(b []byte, name string) []byte {
+		b = protowire.AppendTag(b, 50000, protowire.BytesType)
+		return protowire.AppendString(b, name)
+	}
+	other := protowire.AppendTag(nil, 50001, protowire.VarintType)
+	other = protowire.AppendVarint(other, 7)
+	truncated := protowire.AppendTag(nil, 50000, protowire.BytesType)
+	truncated = protowire.AppendVarint(truncated, 10)
+	truncated = append(truncated, "ab"...)
+	tests := []struct {
+		unknown []byte
+		name    string
+		ok      bool
+	}{
+		{nil, "", false},
+		{override(nil, "Custom"), "Custom", true},
+		{override(other, "Custom"), "Custom", true},
+		{other, "", false},
+		{truncated, "", false},
+		{append(override(nil, "Custom"), truncated...), "", false},
+		{[]byte{0x80}, "", false},
+	}
+	opts := DefaultOptions()
+	opts.NameOption = 50000
+	n := New(opts)
+	for _, test := range tests {
+		options := new(descriptorpb.MessageOptions)
+		options.ProtoReflect().SetUnknown(test.unknown)
+		file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+			Name:        proto.String("override.proto"),
+			Package:     proto.String("override"),
+			MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Foo"), Options: options}},
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		message := file.Messages().Get(0)
+		name, ok := n.NameOverride(message)
+		if name != test.name || ok != test.ok {
+			t.Errorf("NameOverride with unknown bytes %x = %q, %v, want %q, %v", test.unknown, name, ok, test.name, test.ok)
+		}
+		want := test.name
+		if !ok {
+			want = "Override_Foo"
+		}
+		if got := n.FullNameOfMessage(message); got != want {
+			t.Errorf("FullNameOfMessage with unknown bytes %x = %q, want %q", test.unknown, got, want)
+		}
+		if name, ok := New(DefaultOptions()).NameOverride(message); name != "" || ok {
+			t.Errorf("NameOverride without NameOption = %q, %v, want no override", name, ok)
+		}
+	}
+}
+
+// BenchmarkFullNameOfMessage names the 500 top-level messages of a file,
+// computing the type prefix for each message and once with ForFile.
+func BenchmarkFullNameOfMessage(b *testing.B) {
+	fileProto := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("large.proto"),
+		Package: proto.String("company.product.service.v1"),
+	}
+	for i := 0; i < 500; i++ {
+		fileProto.MessageType = append(fileProto.MessageType, &descriptorpb.DescriptorProto{
+			Name: proto.String("Message" + strconv.Itoa(i)),
+		})
+	}
+	file, err := protodesc.NewFile(fileProto, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	n := New(DefaultOptions())
+	benchmarks := []struct {
+		name  string
+		namer *Namer
+	}{
+		{"PerType", n},
+		{"ForFile", n.ForFile(file)},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			messages := file.Messages()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < messages.Len(); j++ {
+					bm.namer.FullNameOfMessage(messages.Get(j))
+				}
+			}
+		})
+	}
+}
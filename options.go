@@ -0,0 +1,576 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/ClarkGuan/protoc-gen-namer/namer"
+)
+
+// options holds the plugin parameters passed by protoc, e.g.
+// --namer_opt=line_ending=crlf.
+type options struct {
+	lineEnding        string
+	protoMessageName  bool
+	minProtoc         []int
+	groupByKind       bool
+	format            string
+	skipUnchanged     bool
+	baseline          string
+	ancestry          bool
+	stats             bool
+	includeMapEntries bool
+	enumOpenness      bool
+	stamp             bool
+	chunkLines        int
+	packageIndex      bool
+	initialization    bool
+	keyWithFile       bool
+	moduleMap         map[string]string
+	failOnEscape      bool
+	slug              bool
+	reverse           bool
+	strict            bool
+	methodTypes       bool
+	out               string
+	collisionSuffix   bool
+	verbose           bool
+	singleFile        bool
+	withSource        bool
+	includeImports    bool
+	validateOnly      bool
+	module            string
+	skipDeprecated    bool
+	maxCollisions     int
+	referenced        bool
+	fieldMaskPaths    bool
+	fieldOrder        bool
+	unrecognized      bool
+	countSynthetic    bool
+	accessorNames     bool
+	protoFieldTypes   bool
+	emitSchema        bool
+	firstEnumValue    bool
+	// naming holds the options of the namer.Namer naming the entities.
+	naming namer.Options
+}
+
+var opts = defaultOptions()
+
+func defaultOptions() options {
+	return options{
+		lineEnding: "\n",
+		format:     "text",
+		naming:     defaultNaming(),
+	}
+}
+
+// defaultNaming returns SwiftProtobuf's naming options with the
+// objc_class_prefix fallback, which prefer_objc_prefix=false turns off.
+func defaultNaming() namer.Options {
+	naming := namer.DefaultOptions()
+	naming.ObjcPrefixFallback = true
+	return naming
+}
+
+// parseOptions sets opts from the parameter string, starting over from the
+// defaults.
+func parseOptions(parameter string) error {
+	opts = defaultOptions()
+	params, err := parseParameters(parameter)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := params[key]
+		switch key {
+		case "line_ending":
+			switch value {
+			case "lf":
+				opts.lineEnding = "\n"
+			case "crlf":
+				opts.lineEnding = "\r\n"
+			default:
+				return fmt.Errorf("invalid line_ending %q: want lf or crlf", value)
+			}
+		case "proto_message_name":
+			if err := parseBool(key, value, &opts.protoMessageName); err != nil {
+				return err
+			}
+		case "min_protoc":
+			version, err := parseVersion(value)
+			if err != nil {
+				return fmt.Errorf("invalid min_protoc %q: %v", value, err)
+			}
+			opts.minProtoc = version
+		case "group_by":
+			if value != "kind" {
+				return fmt.Errorf("invalid group_by %q: want kind", value)
+			}
+			opts.groupByKind = true
+		case "format":
+			switch value {
+			case "text", "json", "swiftdict", "markdown", "properties", "connect", "csv":
+				opts.format = value
+			default:
+				return fmt.Errorf("invalid format %q: want text, json, swiftdict, markdown, properties, connect or csv", value)
+			}
+		case "skip_unchanged":
+			if err := parseBool(key, value, &opts.skipUnchanged); err != nil {
+				return err
+			}
+		case "baseline":
+			opts.baseline = value
+		case "ancestry":
+			if err := parseBool(key, value, &opts.ancestry); err != nil {
+				return err
+			}
+		case "prefix_separator":
+			opts.naming.PrefixSeparator = value
+		case "stats":
+			if err := parseBool(key, value, &opts.stats); err != nil {
+				return err
+			}
+		case "include_map_entries":
+			if err := parseBool(key, value, &opts.includeMapEntries); err != nil {
+				return err
+			}
+		case "enum_openness":
+			if err := parseBool(key, value, &opts.enumOpenness); err != nil {
+				return err
+			}
+		case "stamp":
+			if err := parseBool(key, value, &opts.stamp); err != nil {
+				return err
+			}
+		case "chunk_lines":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid chunk_lines %q: want a positive number", value)
+			}
+			opts.chunkLines = n
+		case "kind_prefix_message", "kind_prefix_enum":
+			if !namer.IsSwiftIdentifier(value) {
+				return fmt.Errorf("invalid %s %q: not a Swift identifier", key, value)
+			}
+			if key == "kind_prefix_message" {
+				opts.naming.KindPrefixMessage = value
+			} else {
+				opts.naming.KindPrefixEnum = value
+			}
+		case "kind_prefix_order":
+			switch value {
+			case "kind_first":
+				opts.naming.KindPrefixFirst = true
+			case "package_first":
+				opts.naming.KindPrefixFirst = false
+			default:
+				return fmt.Errorf("invalid kind_prefix_order %q: want kind_first or package_first", value)
+			}
+		case "package_index":
+			if err := parseBool(key, value, &opts.packageIndex); err != nil {
+				return err
+			}
+		case "initialization":
+			if err := parseBool(key, value, &opts.initialization); err != nil {
+				return err
+			}
+		case "key":
+			switch value {
+			case "name":
+				opts.keyWithFile = false
+			case "file_and_name":
+				opts.keyWithFile = true
+			default:
+				return fmt.Errorf("invalid key %q: want name or file_and_name", value)
+			}
+		case "number_separator":
+			if err := parseBool(key, value, &opts.naming.NumberSeparator); err != nil {
+				return err
+			}
+		case "module_map":
+			opts.moduleMap = make(map[string]string)
+			for _, entry := range strings.Split(value, ",") {
+				i := strings.IndexByte(entry, '=')
+				if i <= 0 || !namer.IsSwiftIdentifier(entry[i+1:]) {
+					return fmt.Errorf("invalid module_map entry %q: want package=Module", entry)
+				}
+				opts.moduleMap[entry[:i]] = entry[i+1:]
+			}
+		case "fail_on_escape":
+			// Names needing escapes, such as foo-bar, are already refused
+			// by protodesc, so the request fails either way; see
+			// checkEscapes.
+			if err := parseBool(key, value, &opts.failOnEscape); err != nil {
+				return err
+			}
+		case "slug":
+			if err := parseBool(key, value, &opts.slug); err != nil {
+				return err
+			}
+		case "reverse":
+			if err := parseBool(key, value, &opts.reverse); err != nil {
+				return err
+			}
+		case "strict":
+			if err := parseBool(key, value, &opts.strict); err != nil {
+				return err
+			}
+		case "name_option":
+			n, err := strconv.ParseInt(value, 10, 32)
+			if err != nil || !protowire.Number(n).IsValid() {
+				return fmt.Errorf("invalid name_option %q: want an extension field number", value)
+			}
+			opts.naming.NameOption = protowire.Number(n)
+		case "method_types":
+			if err := parseBool(key, value, &opts.methodTypes); err != nil {
+				return err
+			}
+		case "out":
+			// protoc refuses to write response files outside its output
+			// directory.
+			clean := path.Clean(value)
+			if len(value) == 0 || path.IsAbs(value) || clean == ".." || strings.HasPrefix(clean, "../") {
+				return fmt.Errorf("invalid out %q: want a path relative to the output directory", value)
+			}
+			opts.out = value
+		case "strip_leading_underscore":
+			if err := parseBool(key, value, &opts.naming.StripLeadingUnderscore); err != nil {
+				return err
+			}
+		case "collision_mode":
+			switch value {
+			case "report":
+				opts.collisionSuffix = false
+			case "suffix":
+				opts.collisionSuffix = true
+			default:
+				return fmt.Errorf("invalid collision_mode %q: want report or suffix", value)
+			}
+		case "verbose":
+			if err := parseBool(key, value, &opts.verbose); err != nil {
+				return err
+			}
+		case "single_file":
+			if err := parseBool(key, value, &opts.singleFile); err != nil {
+				return err
+			}
+		case "ci_reserved":
+			if err := parseBool(key, value, &opts.naming.CIReserved); err != nil {
+				return err
+			}
+		case "abbreviations":
+			for _, word := range strings.Split(value, ",") {
+				if len(word) == 0 || strings.IndexFunc(word, func(c rune) bool { return !unicode.IsLetter(c) }) >= 0 {
+					return fmt.Errorf("invalid abbreviation %q: want a word made of letters", word)
+				}
+				opts.naming.Abbreviations = append(opts.naming.Abbreviations, word)
+			}
+		case "abbreviations_replace":
+			if err := parseBool(key, value, &opts.naming.ReplaceAbbreviations); err != nil {
+				return err
+			}
+		case "case":
+			switch value {
+			case "type":
+				opts.naming.LowerCaseMessages = false
+			case "lower":
+				opts.naming.LowerCaseMessages = true
+			default:
+				return fmt.Errorf("invalid case %q: want type or lower", value)
+			}
+		case "default_prefix":
+			if !protoreflect.FullName(value).IsValid() {
+				return fmt.Errorf("invalid default_prefix %q: want a package name", value)
+			}
+			opts.naming.DefaultPrefix = value
+		case "with_source":
+			if err := parseBool(key, value, &opts.withSource); err != nil {
+				return err
+			}
+		case "include_imports":
+			if err := parseBool(key, value, &opts.includeImports); err != nil {
+				return err
+			}
+		case "no_prefix":
+			if err := parseBool(key, value, &opts.naming.NoPrefix); err != nil {
+				return err
+			}
+		case "sep":
+			// Entries are written as space-separated columns.
+			if utf8.RuneCountInString(value) != 1 || unicode.IsSpace([]rune(value)[0]) {
+				return fmt.Errorf("invalid sep %q: want a single non-space character", value)
+			}
+			opts.naming.Separator = value
+		case "validate_only":
+			if err := parseBool(key, value, &opts.validateOnly); err != nil {
+				return err
+			}
+		case "module":
+			if !namer.IsSwiftIdentifier(value) {
+				return fmt.Errorf("invalid module %q: not a Swift identifier", value)
+			}
+			opts.module = value
+		case "skip_deprecated":
+			if err := parseBool(key, value, &opts.skipDeprecated); err != nil {
+				return err
+			}
+		case "prefer_objc_prefix":
+			if err := parseBool(key, value, &opts.naming.ObjcPrefixFallback); err != nil {
+				return err
+			}
+		case "max_collisions":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid max_collisions %q: want a positive number", value)
+			}
+			opts.maxCollisions = n
+		case "referenced":
+			if err := parseBool(key, value, &opts.referenced); err != nil {
+				return err
+			}
+		case "fieldmask_paths":
+			if err := parseBool(key, value, &opts.fieldMaskPaths); err != nil {
+				return err
+			}
+		case "field_order":
+			if err := parseBool(key, value, &opts.fieldOrder); err != nil {
+				return err
+			}
+		case "unrecognized":
+			if err := parseBool(key, value, &opts.unrecognized); err != nil {
+				return err
+			}
+		case "count_synthetic":
+			// Off by default: the enum value count of stats covers the
+			// declared values only.
+			if err := parseBool(key, value, &opts.countSynthetic); err != nil {
+				return err
+			}
+		case "accessor_names":
+			if err := parseBool(key, value, &opts.accessorNames); err != nil {
+				return err
+			}
+		case "proto_field_types":
+			if err := parseBool(key, value, &opts.protoFieldTypes); err != nil {
+				return err
+			}
+		case "emit_schema":
+			if err := parseBool(key, value, &opts.emitSchema); err != nil {
+				return err
+			}
+		case "first_enum_value":
+			if err := parseBool(key, value, &opts.firstEnumValue); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown parameter %q", key)
+		}
+	}
+	if opts.skipUnchanged && len(opts.baseline) == 0 {
+		return fmt.Errorf("skip_unchanged requires baseline")
+	}
+	if !opts.singleFile {
+		if opts.skipUnchanged {
+			return fmt.Errorf("skip_unchanged requires single_file, as the baseline is a single mapping")
+		}
+		if len(opts.out) > 0 {
+			return fmt.Errorf("out requires single_file")
+		}
+	}
+	if opts.stamp && (opts.format == "json" || opts.format == "csv") {
+		return fmt.Errorf("stamp is not supported by the %s format, which has no comments", opts.format)
+	}
+	if opts.chunkLines > 0 {
+		if opts.format == "swiftdict" || opts.format == "json" {
+			return fmt.Errorf("chunk_lines is not supported by the %s format", opts.format)
+		}
+		if opts.skipUnchanged {
+			return fmt.Errorf("chunk_lines can't be combined with skip_unchanged")
+		}
+		if opts.chunkLines <= chunkHeaderLength() {
+			return fmt.Errorf("chunk_lines must leave room for the %d repeated header lines", chunkHeaderLength())
+		}
+	}
+	if opts.emitSchema && opts.format != "json" {
+		return fmt.Errorf("emit_schema requires format=json, the format it describes")
+	}
+	if opts.ancestry && opts.format != "text" && opts.format != "json" && opts.format != "csv" {
+		return fmt.Errorf("ancestry is only supported by the text, json and csv formats")
+	}
+	textOnly := []struct {
+		name string
+		set  bool
+	}{
+		{"group_by", opts.groupByKind},
+		{"enum_openness", opts.enumOpenness},
+		{"accessor_names", opts.accessorNames},
+		{"field_order", opts.fieldOrder},
+		{"first_enum_value", opts.firstEnumValue},
+		{"initialization", opts.initialization},
+		{"method_types", opts.methodTypes},
+		{"module_map", opts.moduleMap != nil},
+		{"proto_field_types", opts.protoFieldTypes},
+		{"proto_message_name", opts.protoMessageName},
+		{"slug", opts.slug},
+		{"stats", opts.stats},
+		{"with_source", opts.withSource},
+	}
+	for _, option := range textOnly {
+		if option.set && opts.format != "text" {
+			return fmt.Errorf("%s is only supported by the text format", option.name)
+		}
+	}
+	return nil
+}
+
+// parseParameters splits the protoc parameter string into its key=value
+// pairs. A bare key is a flag set to true. module_map and abbreviations take
+// a list, one item per occurrence of the key, e.g.
+// module_map=foo.bar=ModA,module_map=foo.baz=ModB; their values are returned
+// comma-joined.
+func parseParameters(raw string) (map[string]string, error) {
+	params := make(map[string]string)
+	if len(raw) == 0 {
+		return params, nil
+	}
+	lastKey := ""
+	for _, pair := range strings.Split(raw, ",") {
+		if len(pair) == 0 {
+			return nil, fmt.Errorf("empty parameter in %q", raw)
+		}
+		key, value := pair, "true"
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			key, value = pair[:i], pair[i+1:]
+		}
+		if len(key) == 0 {
+			return nil, fmt.Errorf("parameter %q has no name", pair)
+		}
+		if !parameterNames[key] {
+			if listParameters[lastKey] {
+				return nil, fmt.Errorf("unknown parameter %q: repeat %s= for each item of its list", key, lastKey)
+			}
+			return nil, fmt.Errorf("unknown parameter %q", key)
+		}
+		if _, ok := params[key]; ok {
+			if !listParameters[key] {
+				return nil, fmt.Errorf("parameter %q given more than once", key)
+			}
+			params[key] += "," + value
+		} else {
+			params[key] = value
+		}
+		lastKey = key
+	}
+	return params, nil
+}
+
+func parseBool(key, value string, dst *bool) error {
+	if len(value) == 0 {
+		*dst = true
+		return nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: want true or false", key, value)
+	}
+	*dst = b
+	return nil
+}
+
+// parseVersion parses a dotted version such as 3.21 or 3.21.12 into its
+// numeric components.
+func parseVersion(value string) ([]int, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("want major[.minor[.patch]]")
+	}
+	version := make([]int, 0, len(parts))
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("want major[.minor[.patch]]")
+		}
+		version = append(version, n)
+	}
+	return version, nil
+}
+
+// listParameters lists the parameters whose value is a list.
+var listParameters = map[string]bool{
+	"module_map":    true,
+	"abbreviations": true,
+}
+
+// parameterNames lists every parameter parseOptions accepts.
+var parameterNames = map[string]bool{
+	"line_ending":              true,
+	"proto_message_name":       true,
+	"min_protoc":               true,
+	"group_by":                 true,
+	"format":                   true,
+	"skip_unchanged":           true,
+	"baseline":                 true,
+	"ancestry":                 true,
+	"prefix_separator":         true,
+	"stats":                    true,
+	"include_map_entries":      true,
+	"enum_openness":            true,
+	"stamp":                    true,
+	"chunk_lines":              true,
+	"kind_prefix_message":      true,
+	"kind_prefix_enum":         true,
+	"kind_prefix_order":        true,
+	"package_index":            true,
+	"initialization":           true,
+	"key":                      true,
+	"number_separator":         true,
+	"module_map":               true,
+	"fail_on_escape":           true,
+	"slug":                     true,
+	"reverse":                  true,
+	"strict":                   true,
+	"name_option":              true,
+	"method_types":             true,
+	"out":                      true,
+	"strip_leading_underscore": true,
+	"collision_mode":           true,
+	"verbose":                  true,
+	"single_file":              true,
+	"ci_reserved":              true,
+	"abbreviations":            true,
+	"abbreviations_replace":    true,
+	"case":                     true,
+	"default_prefix":           true,
+	"with_source":              true,
+	"include_imports":          true,
+	"no_prefix":                true,
+	"sep":                      true,
+	"validate_only":            true,
+	"module":                   true,
+	"skip_deprecated":          true,
+	"prefer_objc_prefix":       true,
+	"max_collisions":           true,
+	"referenced":               true,
+	"fieldmask_paths":          true,
+	"field_order":              true,
+	"unrecognized":             true,
+	"count_synthetic":          true,
+	"accessor_names":           true,
+	"proto_field_types":        true,
+	"emit_schema":              true,
+	"first_enum_value":         true,
+}
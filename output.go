@@ -0,0 +1,618 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+type entryKind int
+
+const (
+	messageKind entryKind = iota
+	enumKind
+	oneofKind
+	oneofCaseKind
+	fieldKind
+	enumValueKind
+	serviceKind
+	methodKind
+	fieldPathKind
+)
+
+func (k entryKind) String() string {
+	switch k {
+	case messageKind:
+		return "message"
+	case enumKind:
+		return "enum"
+	case oneofKind:
+		return "oneof"
+	case oneofCaseKind:
+		return "oneof_case"
+	case fieldKind:
+		return "field"
+	case enumValueKind:
+		return "enum_value"
+	case serviceKind:
+		return "service"
+	case methodKind:
+		return "method"
+	case fieldPathKind:
+		return "field_path"
+	default:
+		return "unknown"
+	}
+}
+
+var entryKindSections = []struct {
+	kind   entryKind
+	header string
+}{
+	{messageKind, "# Messages"},
+	{enumKind, "# Enums"},
+	{oneofKind, "# Oneofs"},
+	{oneofCaseKind, "# Oneof Cases"},
+	{fieldKind, "# Fields"},
+	{fieldPathKind, "# Field Paths"},
+	{enumValueKind, "# Enum Values"},
+	{serviceKind, "# Services"},
+	{methodKind, "# Methods"},
+}
+
+// entry is one line of the mapping: a key derived from the proto full name,
+// the Swift name SwiftProtobuf generates for it, and any extra columns the
+// options ask for.
+type entry struct {
+	kind      entryKind
+	protoName string
+	swiftName string
+	extra     []string
+	// escaped is set when the entity's own name needed _u escapes.
+	escaped bool
+	// file is the path of the proto file declaring the entity.
+	file string
+	// steps are the naming steps that changed the entity's name, under
+	// stats.
+	steps namingSteps
+	// ancestry lists the Swift names of the enclosing types, under ancestry.
+	ancestry []string
+	// synthetic is set on entries SwiftProtobuf generates without a proto
+	// counterpart, such as the UNRECOGNIZED case of open enums.
+	synthetic bool
+}
+
+func (e entry) columns() []string {
+	return append([]string{e.protoName, e.swiftName}, e.extra...)
+}
+
+// lineWriter is the single place output lines are written, so every line
+// ends with the configured line ending whatever the platform.
+type lineWriter struct {
+	w io.Writer
+}
+
+func (lw *lineWriter) writeLine(columns ...string) {
+	line := strings.TrimRight(strings.Join(columns, " "), "\r\n")
+	_, _ = io.WriteString(lw.w, line+opts.lineEnding)
+}
+
+func outputFileName() string {
+	if len(opts.out) > 0 {
+		return opts.out
+	}
+	switch opts.format {
+	case "json":
+		return "mapper.json"
+	case "swiftdict":
+		return "mapper.swift"
+	case "markdown":
+		return "mapper.md"
+	case "properties":
+		return "mapper.properties"
+	case "csv":
+		return "mapper.csv"
+	default:
+		return "mapper.txt"
+	}
+}
+
+// perFileName names the mapping file of the proto file at protoPath, e.g.
+// foo/bar.proto maps to foo/bar.namer.txt.
+func perFileName(protoPath string) string {
+	return strings.TrimSuffix(protoPath, ".proto") + ".namer" + path.Ext(outputFileName())
+}
+
+// writeStamp writes a comment naming the plugin version and a hash of body.
+// It carries no timestamp, so the same input always stamps the same way.
+func writeStamp(w *lineWriter, body string) {
+	stamp := fmt.Sprintf("%s %s sha256:%x", pluginName, pluginVersion, sha256.Sum256([]byte(body)))
+	switch opts.format {
+	case "swiftdict":
+		w.writeLine("// " + stamp)
+	case "markdown":
+		w.writeLine("<!-- " + stamp + " -->")
+	default:
+		w.writeLine("# " + stamp)
+	}
+}
+
+// outputFiles turns the written mapping into the response files, splitting
+// it into chunk_lines sized files and stamping each when asked to.
+func outputFiles(name, content string) []*pluginpb.CodeGeneratorResponse_File {
+	contents := []string{content}
+	if opts.chunkLines > 0 {
+		contents = chunkContent(content)
+	}
+	var files []*pluginpb.CodeGeneratorResponse_File
+	for i, content := range contents {
+		if opts.stamp {
+			stamped := new(strings.Builder)
+			writeStamp(&lineWriter{w: stamped}, content)
+			stamped.WriteString(content)
+			content = stamped.String()
+		}
+		fileName := name
+		if opts.chunkLines > 0 {
+			ext := path.Ext(name)
+			fileName = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(name, ext), i, ext)
+		}
+		files = append(files, &pluginpb.CodeGeneratorResponse_File{
+			Name: proto.String(fileName), Content: proto.String(content)})
+	}
+	return files
+}
+
+// chunkHeaderLength returns the number of lines every chunk has to repeat to
+// stand on its own: the stamp, the text or table header and the group_by
+// section header.
+func chunkHeaderLength() int {
+	n := textHeaderLength() + tableHeaderLength()
+	if opts.stamp {
+		n++
+	}
+	if opts.groupByKind {
+		n++
+	}
+	return n
+}
+
+// textHeaderLength is the number of lines of the header renderMapping starts
+// text output with.
+func textHeaderLength() int {
+	switch {
+	case opts.format != "text":
+		return 0
+	case opts.singleFile:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// chunkContent splits content into chunks of at most chunk_lines lines. Each
+// chunk repeats the text header or the Markdown or CSV table header and, with
+// group_by, the header of the section it continues. Empty sections are left
+// out.
+func chunkContent(content string) []string {
+	lines := strings.SplitAfter(content, opts.lineEnding)
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	var fixed []string
+	if n := textHeaderLength() + tableHeaderLength(); n > 0 {
+		fixed, lines = lines[:n], lines[n:]
+	}
+	limit := opts.chunkLines
+	if opts.stamp {
+		limit--
+	}
+	var chunks []string
+	var current []string
+	section := ""
+	sectionHeader := func(line string) bool {
+		return opts.groupByKind && isSectionHeader(strings.TrimSuffix(line, opts.lineEnding))
+	}
+	for i, line := range lines {
+		isSection := sectionHeader(line)
+		// A section without entries would leave chunks of bare headers,
+		// and a section header never ends a chunk.
+		if isSection && (i+1 == len(lines) || sectionHeader(lines[i+1])) {
+			continue
+		}
+		if len(current) == 0 || len(current) >= limit || isSection && len(current) == limit-1 {
+			if len(current) > 0 {
+				chunks = append(chunks, strings.Join(current, ""))
+			}
+			current = append([]string(nil), fixed...)
+			if len(section) > 0 && !isSection {
+				current = append(current, section)
+			}
+		}
+		if isSection {
+			section = line
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 || len(chunks) == 0 {
+		chunks = append(chunks, strings.Join(current, ""))
+	}
+	return chunks
+}
+
+func isSectionHeader(line string) bool {
+	for _, section := range entryKindSections {
+		if line == section.header {
+			return true
+		}
+	}
+	return false
+}
+
+func writeEntries(w *lineWriter, entries []entry) error {
+	switch opts.format {
+	case "json":
+		return writeJSON(w, entries)
+	case "swiftdict":
+		writeSwiftDict(w, entries)
+	case "markdown":
+		writeMarkdown(w, entries)
+	case "properties":
+		writeProperties(w, entries)
+	case "connect":
+		writeConnect(w, entries)
+	case "csv":
+		return writeCSV(w, entries)
+	default:
+		writeText(w, entries)
+		if opts.stats {
+			writeStats(w, entries)
+		}
+	}
+	return nil
+}
+
+func writeText(w *lineWriter, entries []entry) {
+	if !opts.groupByKind {
+		for _, e := range sortedEntries(entries) {
+			w.writeLine(e.columns()...)
+		}
+		return
+	}
+	for _, section := range entryKindSections {
+		var group []entry
+		for _, e := range entries {
+			if e.kind == section.kind {
+				group = append(group, e)
+			}
+		}
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].protoName < group[j].protoName
+		})
+		w.writeLine(section.header)
+		for _, e := range group {
+			w.writeLine(e.columns()...)
+		}
+	}
+}
+
+// writeJSON writes the mapping as a JSON object with one member per entity
+// kind, such as "messages" or "enum_values", each mapping proto full names to
+// Swift names. Under ancestry, each Swift name becomes a jsonEntry.
+// encoding/json sorts the keys.
+func writeJSON(w *lineWriter, entries []entry) error {
+	groups := make(map[string]map[string]interface{})
+	for _, section := range entryKindSections {
+		groups[jsonGroup(section.kind)] = make(map[string]interface{})
+	}
+	for _, e := range entries {
+		if opts.ancestry {
+			groups[jsonGroup(e.kind)][e.protoName] = jsonEntry{SwiftName: e.swiftName, Ancestry: e.ancestry}
+		} else {
+			groups[jsonGroup(e.kind)][e.protoName] = e.swiftName
+		}
+	}
+	content, err := json.MarshalIndent(groups, "", "  ")
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		w.writeLine(line)
+	}
+	return nil
+}
+
+// jsonGroup names the member of the JSON mapping listing entities of kind.
+func jsonGroup(kind entryKind) string {
+	return kind.String() + "s"
+}
+
+// jsonEntry is an entity of the JSON mapping under ancestry.
+type jsonEntry struct {
+	SwiftName string   `json:"swift_name"`
+	Ancestry  []string `json:"ancestry"`
+}
+
+// writeSchema writes the JSON Schema of the mapping writeJSON writes with
+// the current options. It is derived from entryKindSections and jsonEntry
+// so it follows any change to the JSON output.
+func writeSchema(w *lineWriter) error {
+	value := map[string]interface{}{"type": "string"}
+	if opts.ancestry {
+		value = objectSchema(reflect.TypeOf(jsonEntry{}))
+	}
+	properties := make(map[string]interface{})
+	required := make([]string, 0, len(entryKindSections))
+	for _, section := range entryKindSections {
+		group := jsonGroup(section.kind)
+		properties[group] = map[string]interface{}{"type": "object", "additionalProperties": value}
+		required = append(required, group)
+	}
+	schema := map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                pluginName + " mapping",
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+	content, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		w.writeLine(line)
+	}
+	return nil
+}
+
+// objectSchema describes the JSON encoding of the struct type t, whose fields
+// are strings or string slices, all of them required.
+func objectSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("json")
+		if field.Type.Kind() == reflect.Slice {
+			properties[name] = map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}
+		} else {
+			properties[name] = map[string]interface{}{"type": "string"}
+		}
+		required = append(required, name)
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// writeSwiftDict writes the mapping as a Swift dictionary literal that can be
+// pasted into Swift source.
+func writeSwiftDict(w *lineWriter, entries []entry) {
+	sorted := sortedEntries(entries)
+	if len(sorted) == 0 {
+		w.writeLine("let protoNameMap: [String: String] = [:]")
+		return
+	}
+	w.writeLine("let protoNameMap: [String: String] = [")
+	for _, e := range sorted {
+		w.writeLine("    " + swiftStringLiteral(e.protoName) + ": " + swiftStringLiteral(e.swiftName) + ",")
+	}
+	w.writeLine("]")
+}
+
+// writeMarkdown writes the mapping as a GitHub-flavored Markdown table.
+var markdownHeader = []string{
+	"| Proto Name | Swift Name | Kind |",
+	"| --- | --- | --- |",
+}
+
+func writeMarkdown(w *lineWriter, entries []entry) {
+	for _, line := range markdownHeader {
+		w.writeLine(line)
+	}
+	for _, e := range sortedEntries(entries) {
+		w.writeLine("| " + markdownCell(e.protoName) + " | " + markdownCell(e.swiftName) + " | " + e.kind.String() + " |")
+	}
+}
+
+func markdownCell(s string) string {
+	return strings.Replace(s, "|", `\|`, -1)
+}
+
+// writeCSV writes the mapping as CSV with a header row. Under ancestry, a
+// last column lists the enclosing Swift names joined with slashes.
+func writeCSV(w *lineWriter, entries []entry) error {
+	records := [][]string{csvHeader()}
+	for _, e := range sortedEntries(entries) {
+		record := []string{e.kind.String(), e.protoName, e.swiftName}
+		if opts.ancestry {
+			record = append(record, strings.Join(e.ancestry, "/"))
+		}
+		records = append(records, record)
+	}
+	for _, record := range records {
+		line, err := csvRecord(record)
+		if err != nil {
+			return err
+		}
+		w.writeLine(line)
+	}
+	return nil
+}
+
+func csvHeader() []string {
+	header := []string{"kind", "proto_full_name", "swift_name"}
+	if opts.ancestry {
+		header = append(header, "ancestry")
+	}
+	return header
+}
+
+// csvRecord quotes record as one CSV line, leaving the line ending to
+// lineWriter.
+func csvRecord(record []string) (string, error) {
+	b := new(strings.Builder)
+	cw := csv.NewWriter(b)
+	if err := cw.Write(record); err != nil {
+		return "", err
+	}
+	cw.Flush()
+	return b.String(), cw.Error()
+}
+
+// tableHeaderLength returns the number of header lines of the table formats.
+func tableHeaderLength() int {
+	switch opts.format {
+	case "markdown":
+		return len(markdownHeader)
+	case "csv":
+		return 1
+	}
+	return 0
+}
+
+// writeProperties writes the mapping as a Java .properties file.
+func writeProperties(w *lineWriter, entries []entry) {
+	for _, e := range sortedEntries(entries) {
+		w.writeLine(propertiesEscape(e.protoName, true) + "=" + propertiesEscape(e.swiftName, false))
+	}
+}
+
+// propertiesEscape escapes s as a .properties key or value. Non-ASCII
+// characters are written as \uXXXX since readers default to ISO-8859-1.
+func propertiesEscape(s string, key bool) string {
+	b := new(strings.Builder)
+	for i, c := range s {
+		switch c {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '=', ':', '#', '!':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case ' ':
+			if key || i == 0 {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(c)
+		default:
+			if c < 0x20 || c > 0x7e {
+				for _, u := range utf16.Encode([]rune{c}) {
+					_, _ = fmt.Fprintf(b, `\u%04X`, u)
+				}
+			} else {
+				b.WriteRune(c)
+			}
+		}
+	}
+	return b.String()
+}
+
+// writeConnect writes only the RPC methods, keyed by the package.Service/Method
+// procedure path Connect uses to address them.
+func writeConnect(w *lineWriter, entries []entry) {
+	for _, e := range sortedEntries(entries) {
+		if e.kind != methodKind {
+			continue
+		}
+		i := strings.LastIndexByte(e.protoName, '.')
+		w.writeLine(e.protoName[:i]+"/"+e.protoName[i+1:], e.swiftName)
+	}
+}
+
+func sortedEntries(entries []entry) []entry {
+	sorted := make([]entry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].protoName < sorted[j].protoName
+	})
+	return sorted
+}
+
+func swiftStringLiteral(s string) string {
+	b := new(strings.Builder)
+	b.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case 0:
+			b.WriteString(`\0`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				_, _ = fmt.Fprintf(b, `\u{%x}`, c)
+			} else {
+				b.WriteRune(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// writeReverse writes one line per Swift name, sorted, followed by every proto
+// name that maps to it, so names several proto types share stay visible.
+func writeReverse(w *lineWriter, entries []entry) {
+	protoNames := make(map[string][]string)
+	for _, e := range entries {
+		protoNames[e.swiftName] = append(protoNames[e.swiftName], e.protoName)
+	}
+	swiftNames := make([]string, 0, len(protoNames))
+	for swiftName := range protoNames {
+		swiftNames = append(swiftNames, swiftName)
+	}
+	sort.Strings(swiftNames)
+	for _, swiftName := range swiftNames {
+		names := protoNames[swiftName]
+		sort.Strings(names)
+		w.writeLine(append([]string{swiftName}, names...)...)
+	}
+}
+
+// writePackageIndex writes one line per package, sorted, listing the files
+// that declare it. Files without a package are listed under <none>.
+func writePackageIndex(w *lineWriter, packageFiles map[string][]string) {
+	packages := make([]string, 0, len(packageFiles))
+	for pkg := range packageFiles {
+		packages = append(packages, pkg)
+	}
+	sort.Strings(packages)
+	for _, pkg := range packages {
+		files := append([]string(nil), packageFiles[pkg]...)
+		sort.Strings(files)
+		name := pkg
+		if len(name) == 0 {
+			name = "<none>"
+		}
+		w.writeLine(append([]string{name}, files...)...)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strconv"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/ClarkGuan/protoc-gen-namer/namer"
+)
+
+// namingSteps records which naming steps changed an entity's proto name on
+// its way to the Swift name. stats sums them over the entries of a mapping.
+type namingSteps struct {
+	camelCased    bool
+	prefixed      bool
+	disambiguated bool
+}
+
+// stepsOf returns the naming steps applied to desc's own relative name.
+// Enclosing types are accounted for by their own entries.
+func stepsOf(n *namer.Namer, desc protoreflect.Descriptor) namingSteps {
+	var steps namingSteps
+	switch d := desc.(type) {
+	case protoreflect.MessageDescriptor:
+		// An override is used as it is, and case=lower only camel-cases.
+		if _, ok := n.NameOverride(d); ok {
+			break
+		}
+		if n.Options().LowerCaseMessages {
+			steps.camelCased = n.RelativeNameOfMessage(d) != string(d.Name())
+			break
+		}
+		base := steps.prefix(n, d)
+		steps.disambiguated = n.RelativeNameOfMessage(d) != base
+	case protoreflect.EnumDescriptor:
+		base := steps.prefix(n, d)
+		steps.disambiguated = n.RelativeNameOfEnum(d) != base
+	case protoreflect.OneofDescriptor:
+		camelCase := n.ToUpperCamelCase(string(d.Name()))
+		steps.camelCased = camelCase != string(d.Name())
+		steps.disambiguated = n.RelativeNameOfOneof(d) != "OneOf_"+camelCase
+	case protoreflect.FieldDescriptor:
+		camelCase := n.ToLowerCamelCase(string(d.Name()))
+		steps.camelCased = camelCase != string(d.Name())
+		steps.disambiguated = n.RelativeNameOfField(d) != camelCase
+	case protoreflect.ServiceDescriptor:
+		base := steps.prefix(n, d)
+		steps.disambiguated = n.RelativeNameOfService(d) != base
+	case protoreflect.MethodDescriptor:
+		camelCase := n.ToLowerCamelCase(string(d.Name()))
+		steps.camelCased = camelCase != string(d.Name())
+		steps.disambiguated = n.RelativeNameOfMethod(d) != camelCase
+	case protoreflect.EnumValueDescriptor:
+		steps.camelCased = n.RelativeNameOfEnumValue(d) != string(d.Name())
+	}
+	return steps
+}
+
+// prefix notes whether a top-level type gets a prefix and returns its name
+// before sanitizing.
+func (s *namingSteps) prefix(n *namer.Namer, desc protoreflect.Descriptor) string {
+	if _, ok := desc.Parent().(protoreflect.MessageDescriptor); ok {
+		return string(desc.Name())
+	}
+	prefix := n.TopLevelPrefix(desc)
+	s.prefixed = len(prefix) > 0
+	return prefix + string(desc.Name())
+}
+
+// writeStats writes how many of entries each naming step changed, and how
+// many enum values they list. Synthetic values such as UNRECOGNIZED are only
+// counted under count_synthetic.
+func writeStats(w *lineWriter, entries []entry) {
+	var camelCased, prefixed, disambiguated, enumValues int
+	for _, e := range entries {
+		if e.kind == enumValueKind && (!e.synthetic || opts.countSynthetic) {
+			enumValues++
+		}
+		if e.steps.camelCased {
+			camelCased++
+		}
+		if e.steps.prefixed {
+			prefixed++
+		}
+		if e.steps.disambiguated {
+			disambiguated++
+		}
+	}
+	w.writeLine("# camel-cased:", strconv.Itoa(camelCased))
+	w.writeLine("# prefixed:", strconv.Itoa(prefixed))
+	w.writeLine("# disambiguated:", strconv.Itoa(disambiguated))
+	w.writeLine("# enum values:", strconv.Itoa(enumValues))
+}